@@ -15,19 +15,14 @@
 package cmd
 
 import (
+	"github.com/rgeyer/93l56r-cli/programmer"
 	"github.com/spf13/cobra"
 )
 
 // cmCmd represents the cm command
 var cmCmd = &cobra.Command{
 	Use:   "cm",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+	Short: "Works with the EEPROMs of the combination meter",
 }
 
 func init() {
@@ -38,6 +33,8 @@ func init() {
 	// Cobra supports Persistent Flags which will work for this command
 	// and all subcommands, e.g.:
 	// cmCmd.PersistentFlags().String("foo", "", "A help for foo")
+	cmCmd.PersistentFlags().StringVar(&serPort, "serial-port", "", "Device path or name for the serial port your arduino is connected to. I.E. COM1, /dev/cu.usbmodem*, auto to find the only connected programmer, or sim://path/to/image.bin to use a simulated EEPROM")
+	cmCmd.PersistentFlags().IntVar(&baudRate, "baud", programmer.DefaultBaudRate, "The baud rate to switch the Arduino to once connected. Falls back to 9600 if the Arduino does not respond at this rate")
 
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
@@ -15,15 +15,31 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/rgeyer/93l56r-cli/programmer"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 var serPort string
 var eepromAddr int
 var icType string
+var baudRate int
+var i2cAddress int
+var i2cAddressBytes int
+var i2cBlockSelectBits int
+var chipName string
+var microwireOrg int
+var microwireAddressBits int
+
+// chip is the part selected with the --chip flag, or nil.
+var chip *programmer.Chip
 
 // eepromCmd represents the eeprom command
 var eepromCmd = &cobra.Command{
@@ -36,18 +52,27 @@ Cobra is a CLI library for Go that empowers applications.
 This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-		if serPort == "" {
-			errorMsg := "You must supply the --serial-port flag."
-			return errors.New(errorMsg)
+		if err := checkSerialPort(cmd, args); err != nil {
+			return err
+		}
+		if microwireOrg != 8 && microwireOrg != 16 {
+			return fmt.Errorf("The --org flag must be 8 or 16, not %d", microwireOrg)
+		}
+		// Checked before it is converted to a device address byte
+		if i2cAddress < programmer.FirstI2CAddress || i2cAddress > programmer.LastI2CAddress {
+			return fmt.Errorf("The --i2c-address must be between 0x%02X and 0x%02X, not 0x%X", programmer.FirstI2CAddress, programmer.LastI2CAddress, i2cAddress)
+		}
+		if err := selectChip(cmd); err != nil {
+			return err
 		}
 
-		switch test := icType; test {
-		case "microwire":
+		switch test := programmer.IcType(icType); test {
+		case programmer.Microwire:
 			break
-		case "i2c":
+		case programmer.I2C:
 			break
 		default:
-			return errors.New("You must supply the --type flag, and it must be one of: microwire, i2c")
+			return errors.New("You must supply the --type or --chip flag, and --type must be one of: microwire, i2c")
 		}
 		return nil
 	},
@@ -56,12 +81,195 @@ to quickly create a Cobra application.`,
 	},
 }
 
+// checkSerialPort checks the --serial-port flag was supplied. It is the
+// PersistentPreRunE of eeprom commands which do not need the --type flag.
+func checkSerialPort(cmd *cobra.Command, args []string) error {
+	if serPort == "" {
+		errorMsg := "You must supply the --serial-port flag."
+		return errors.New(errorMsg)
+	}
+	return nil
+}
+
+// selectChip looks up the part named by the --chip flag, and uses it for
+// every flag which was not supplied.
+func selectChip(cmd *cobra.Command) error {
+	if chipName == "" {
+		return nil
+	}
+	c, err := programmer.LookupChip(chipName)
+	if err != nil {
+		return err
+	}
+	if cmd.Flags().Changed("type") && programmer.IcType(icType) != c.IcType {
+		return fmt.Errorf("The %s is a %s EEPROM, but --type is %s", c.Name, c.IcType, icType)
+	}
+	icType = string(c.IcType)
+	if c, err = c.Organized(microwireOrg); err != nil {
+		return err
+	}
+	if c.IcType == programmer.Microwire && !cmd.Flags().Changed("microwire-address-bits") {
+		microwireAddressBits = c.AddressBits
+	}
+	if c.IcType == programmer.I2C {
+		if !cmd.Flags().Changed("i2c-address-bytes") {
+			i2cAddressBytes = c.I2CAddressBytes
+		}
+		if !cmd.Flags().Changed("i2c-block-select-bits") {
+			i2cBlockSelectBits = c.I2CBlockSelectBits
+		}
+	}
+	chip = &c
+	return nil
+}
+
+// checkChipRange returns an error if the length bytes starting at the
+// --start-address are not within the part selected with --chip.
+func checkChipRange(length int) error {
+	if chip == nil {
+		return nil
+	}
+	return chip.CheckRange(eepromAddr, length)
+}
+
+// checkMicrowire returns an error unless the EEPROM is a Microwire EEPROM,
+// for commands which send Microwire instructions.
+func checkMicrowire(cmd *cobra.Command) error {
+	if programmer.IcType(icType) != programmer.Microwire {
+		return fmt.Errorf("The %s command is only supported for Microwire EEPROMs, not %s", cmd.Name(), icType)
+	}
+	return nil
+}
+
+// microwireController returns prog as a programmer.MicrowireController, or an
+// error if it can not send Microwire control instructions.
+func microwireController(cmd *cobra.Command, prog programmer.Programmer) (programmer.MicrowireController, error) {
+	mc, ok := prog.(programmer.MicrowireController)
+	if !ok {
+		return nil, fmt.Errorf("The %s command needs a programmer which can send Microwire write-enable and erase instructions, which this one can not", cmd.Name())
+	}
+	return mc, nil
+}
+
+// eepromSize returns the size of the EEPROM in bytes, from the --chip flag, or
+// the Microwire organization and address bits. Without either, Microwire
+// EEPROMs are the 93L56R, which ignores the top address bit in x16 mode. It is
+// 0 when not known, I.E. for I2C EEPROMs without --chip.
+func eepromSize() int {
+	if chip != nil {
+		return chip.Size
+	}
+	if programmer.IcType(icType) == programmer.Microwire {
+		if microwireAddressBits == programmer.DefaultMicrowireAddressBits {
+			return programmer.Chips["93L56R"].Size
+		}
+		return (1 << uint(microwireAddressBits)) * microwireOrg / 8
+	}
+	return 0
+}
+
+// checkFilled reads back the length bytes starting at addr, and returns an
+// error unless every word holds word.
+func checkFilled(ctx context.Context, prog programmer.Programmer, addr int, length int, word []byte) error {
+	buf, err := prog.Read(ctx, addr, length, programmer.IcType(icType))
+	if err != nil {
+		return err
+	}
+	expected := bytes.Repeat(word, length/len(word))
+	if mismatches := compareWords(addr, expected, buf, len(word)); len(mismatches) > 0 {
+		m := mismatches[0]
+		return fmt.Errorf("%d of %d words were not set to 0x%X, the first at address 0x%04X is 0x%X. The EEPROM may be write protected", len(mismatches), length/len(word), m.expected, m.addr, m.actual)
+	}
+	return nil
+}
+
+// newProgrammer returns the Programmer for the --serial-port flag.
+func newProgrammer() programmer.Programmer {
+	prog := programmer.NewArduino93L56R(serPort)
+	prog.SetResponseTimeout(viper.GetDuration("response-timeout"))
+	prog.SetBaudRate(baudRate)
+	prog.SetI2CAddress(byte(i2cAddress))
+	prog.SetI2CAddressBytes(i2cAddressBytes)
+	prog.SetI2CBlockSelectBits(i2cBlockSelectBits)
+	prog.SetMicrowireOrganization(microwireOrg)
+	prog.SetMicrowireAddressBits(microwireAddressBits)
+	if chip != nil && chip.IcType == programmer.I2C {
+		prog.SetI2CPageSize(chip.PageSize)
+	}
+	prog.SetProgress(newProgressBar().update)
+	return prog
+}
+
+// progressBarWidth is the number of characters in a progress bar.
+const progressBarWidth = 30
+
+// progressBar prints the progress of programmer operations, and their
+// throughput so far, redrawing a single line until the operation finishes.
+type progressBar struct {
+	start time.Time
+	// open is true while the line has been drawn, but not finished
+	open bool
+}
+
+// activeProgress is the progress bar of the programmer of the command, if any.
+var activeProgress *progressBar
+
+func newProgressBar() *progressBar {
+	activeProgress = &progressBar{}
+	return activeProgress
+}
+
+// update is called by the programmer with the number of bytes done so far,
+// which is zero when an operation starts.
+func (p *progressBar) update(done, total int) {
+	if done == 0 {
+		p.end()
+		p.start = time.Now()
+		return
+	}
+	filled := done * progressBarWidth / total
+	rate := float64(done) / time.Since(p.start).Seconds()
+	fmt.Printf("\r[%s%s] %3d%% %d/%d bytes, %.0f bytes/s", strings.Repeat("#", filled), strings.Repeat(".", progressBarWidth-filled), done*100/total, done, total, rate)
+	p.open = true
+	if done >= total {
+		p.end()
+	}
+}
+
+// end finishes the line of an operation which stopped part way through, so
+// that whatever is printed next starts on a line of its own.
+func (p *progressBar) end() {
+	if p.open {
+		fmt.Println()
+		p.open = false
+	}
+}
+
+// endProgress ends the line of the active progress bar, if there is one.
+func endProgress() {
+	if activeProgress != nil {
+		activeProgress.end()
+	}
+}
+
+// throughput describes how fast n bytes were transferred by prog in d.
+func throughput(prog programmer.Programmer, n int, d time.Duration) string {
+	return fmt.Sprintf("%d bytes in %s, %.0f bytes/s at %d baud", n, d.Round(time.Millisecond), float64(n)/d.Seconds(), prog.BaudRate())
+}
+
 func init() {
 	rootCmd.AddCommand(eepromCmd)
 
-	eepromCmd.PersistentFlags().StringVar(&serPort, "serial-port", "", "Device path or name for the serial port your arduino is connected to. I.E. COM1, /dev/cu.usbmodem*")
+	eepromCmd.PersistentFlags().StringVar(&serPort, "serial-port", "", "Device path or name for the serial port your arduino is connected to. I.E. COM1, /dev/cu.usbmodem*, auto to find the only connected programmer, or sim://path/to/image.bin to use a simulated EEPROM")
+	eepromCmd.PersistentFlags().IntVar(&baudRate, "baud", programmer.DefaultBaudRate, "The baud rate to switch the Arduino to once connected. Falls back to 9600 if the Arduino does not respond at this rate")
 	eepromCmd.PersistentFlags().IntVar(&eepromAddr, "start-address", 0, "The starting address of the EEPROM to begin the read or write operation. Default is 0")
-	eepromCmd.PersistentFlags().StringVar(&icType, "type", "", "The type of EEPROM you're trying to read. One of: microwire, i2c")
+	eepromCmd.PersistentFlags().StringVar(&icType, "type", "", "The type of EEPROM you're trying to read. One of: microwire, i2c. Not needed with --chip")
+	eepromCmd.PersistentFlags().StringVar(&chipName, "chip", "", "The part number of the EEPROM, I.E. 93C56 or 24C16. Sets --type, the I2C flags and the default lengths, and checks addresses are within the part. One of: "+strings.Join(programmer.ChipNames(), ", "))
+	eepromCmd.PersistentFlags().IntVar(&microwireOrg, "org", programmer.DefaultMicrowireOrganization, "The organization of Microwire EEPROMs, 16 or 8 bits per address, as set by their ORG pin. Addresses are in words of this size")
+	eepromCmd.PersistentFlags().IntVar(&microwireAddressBits, "microwire-address-bits", programmer.DefaultMicrowireAddressBits, "The number of address bits the Microwire EEPROM expects, I.E. 6 for a x16 93C46 up to 11 for a x8 93C86. Default is 8, set by --chip")
+	eepromCmd.PersistentFlags().IntVar(&i2cAddress, "i2c-address", programmer.DefaultI2CAddress, "The I2C device address of the EEPROM. Default is 0x50")
+	eepromCmd.PersistentFlags().IntVar(&i2cAddressBytes, "i2c-address-bytes", 1, "The number of address bytes the I2C EEPROM expects. 1 for parts up to 24C16, 2 for 24C32 to 24C512")
+	eepromCmd.PersistentFlags().IntVar(&i2cBlockSelectBits, "i2c-block-select-bits", 0, "The number of low I2C device address bits the EEPROM uses to select a 256 byte block. 1 for the 24C04, 2 for the 24C08, 3 for the 24C16")
 
 	// Here you will define your flags and configuration settings.
 
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureStdout returns what f prints.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	f()
+	os.Stdout = stdout
+	w.Close()
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestProgressBar(t *testing.T) {
+	out := captureStdout(t, func() {
+		p := newProgressBar()
+		p.update(0, 64)
+		p.update(32, 64)
+		p.update(64, 64)
+		// Stopped part way through
+		p.update(0, 64)
+		p.update(16, 64)
+		endProgress()
+		endProgress()
+	})
+
+	lines := strings.Split(out, "\n")
+	if len(lines) != 3 || lines[2] != "" {
+		t.Fatalf("Expected two lines, one for each operation, got %q", out)
+	}
+	if strings.Count(lines[0], "\r") != 2 || !strings.Contains(lines[0], "100% 64/64 bytes") {
+		t.Fatalf("Expected the first line to be redrawn up to 100%%, got %q", lines[0])
+	}
+	if strings.Count(lines[1], "\r") != 1 || !strings.Contains(lines[1], " 25% 16/64 bytes") {
+		t.Fatalf("Expected the second line to stop at 25%%, got %q", lines[1])
+	}
+}
+
+func TestEepromSize(t *testing.T) {
+	defer func(typ string, org, bits int) { icType, microwireOrg, microwireAddressBits = typ, org, bits }(icType, microwireOrg, microwireAddressBits)
+
+	cases := []struct {
+		icType   string
+		org      int
+		addrBits int
+		expected int
+	}{
+		{"microwire", 16, 8, 256},
+		{"microwire", 8, 8, 256},
+		{"microwire", 16, 6, 128},
+		{"microwire", 8, 11, 2048},
+		{"i2c", 16, 8, 0},
+	}
+	for _, c := range cases {
+		icType, microwireOrg, microwireAddressBits = c.icType, c.org, c.addrBits
+		if size := eepromSize(); size != c.expected {
+			t.Errorf("Expected %d bytes for a x%d %s EEPROM with %d address bits, got %d", c.expected, c.org, c.icType, c.addrBits, size)
+		}
+	}
+}
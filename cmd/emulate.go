@@ -0,0 +1,94 @@
+// Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rgeyer/93l56r-cli/programmer"
+	"github.com/spf13/cobra"
+)
+
+var emulatePty bool
+var emulateImage string
+var emulateFaults []string
+
+// emulateCmd represents the emulate command
+var emulateCmd = &cobra.Command{
+	Use:   "emulate",
+	Short: "Emulates an Arduino running the subaru immo sketch on a pseudo terminal",
+	Long: `Emulates an Arduino running the subaru immo sketch on a pseudo terminal, keeping
+the EEPROM contents in the --image file. The path of the pseudo terminal is
+printed, and can be used as the --serial-port of any other command.
+
+Use --fault to simulate a bad connection. Each fault is a
+kind:direction:offset[:count|delay] spec, where kind is one of drop, corrupt,
+delay, truncate or reset, direction is out (requests to the emulated Arduino)
+or in (its responses), and offset counts the bytes sent in that direction so
+far. I.E.
+--fault drop:out:5:2 --fault delay:out:0:500ms
+
+The emulator runs until it is interrupted.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if !emulatePty {
+			errorMsg := "You must supply the --pty flag. A pseudo terminal is currently the only way to emulate an Arduino."
+			return errors.New(errorMsg)
+		}
+		if emulateImage == "" {
+			errorMsg := "You must supply the --image flag."
+			return errors.New(errorMsg)
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var faults []programmer.Fault
+		for _, spec := range emulateFaults {
+			fault, err := programmer.ParseFault(spec)
+			if err != nil {
+				return err
+			}
+			faults = append(faults, fault)
+		}
+
+		emulator, err := programmer.NewEmulator(emulateImage)
+		if err != nil {
+			return err
+		}
+		defer emulator.Close()
+		emulator.InjectFaults(faults...)
+
+		fmt.Printf("Emulating an Arduino on %s\n", emulator.SlavePath)
+
+		return emulator.Serve()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(emulateCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// emulateCmd.PersistentFlags().String("foo", "", "A help for foo")
+	emulateCmd.Flags().BoolVar(&emulatePty, "pty", false, "Emulate the Arduino on a pseudo terminal")
+	emulateCmd.Flags().StringArrayVar(&emulateFaults, "fault", nil, "A fault to inject, as kind:direction:offset[:count|delay]. May be repeated")
+	emulateCmd.Flags().StringVar(&emulateImage, "image", "", "A file to keep the EEPROM contents in. It is created on the first write if it does not exist yet. Append ?protocol=1 to emulate a sketch which only supports protocol version 1")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	// emulateCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+}
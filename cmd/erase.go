@@ -0,0 +1,103 @@
+// Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rgeyer/93l56r-cli/programmer"
+	"github.com/spf13/cobra"
+)
+
+var eraseLen int
+var eraseAll bool
+
+// eraseCmd represents the erase command
+var eraseCmd = &cobra.Command{
+	Use:   "erase",
+	Short: "Erases words of a Microwire EEPROM, or the whole EEPROM",
+	Long: `Erases, I.E. sets to 0xFF, the word at --start-address of a Microwire EEPROM.
+Use --length to erase a range of bytes starting at --start-address, or --all to
+erase the whole EEPROM with a single ERAL instruction.
+
+The EEPROM is write-enabled for the erase, and always write-disabled again
+afterwards. What was erased is read back to check it.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkMicrowire(cmd); err != nil {
+			return err
+		}
+		if eraseAll && (cmd.Flags().Changed("length") || cmd.Flags().Changed("start-address")) {
+			errorMsg := "You must not supply the --start-address or --length flags with --all."
+			return errors.New(errorMsg)
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := commandContext()
+		defer cancel()
+
+		prog := newProgrammer()
+		mc, err := microwireController(cmd, prog)
+		if err != nil {
+			return err
+		}
+		length := eraseLen
+		if length == 0 {
+			length = prog.WordSize(programmer.Microwire)
+		}
+		if eraseAll {
+			length = eepromSize()
+		}
+		if err := checkChipRange(length); err != nil {
+			return err
+		}
+
+		if err := prog.Connect(ctx); err != nil {
+			return err
+		}
+		defer prog.Close()
+
+		if eraseAll {
+			if err := mc.EraseAllMicrowire(ctx); err != nil {
+				return err
+			}
+		} else if err := mc.EraseMicrowire(ctx, eepromAddr, length); err != nil {
+			return err
+		}
+
+		if err := checkFilled(ctx, prog, eepromAddr, length, []byte{0xFF, 0xFF}[:prog.WordSize(programmer.Microwire)]); err != nil {
+			return err
+		}
+		fmt.Printf("Erased %d bytes starting at address 0x%X.\n", length, eepromAddr)
+		return nil
+	},
+}
+
+func init() {
+	eepromCmd.AddCommand(eraseCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// eraseCmd.PersistentFlags().String("foo", "", "A help for foo")
+	eraseCmd.Flags().IntVar(&eraseLen, "length", 0, "The number of bytes to erase, starting at --start-address. Default is a single word")
+	eraseCmd.Flags().BoolVar(&eraseAll, "all", false, "Erase the whole EEPROM")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	// eraseCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+}
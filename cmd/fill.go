@@ -0,0 +1,125 @@
+// Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/rgeyer/93l56r-cli/programmer"
+	"github.com/spf13/cobra"
+)
+
+var fillPattern string
+var fillLen int
+
+// fillCmd represents the fill command
+var fillCmd = &cobra.Command{
+	Use:   "fill",
+	Short: "Writes the same word to every address of the EEPROM",
+	Long: `Writes the --pattern word, I.E. 0xFFFF for a x16 Microwire EEPROM or 0xFF for
+an I2C EEPROM, to every address of the EEPROM. A whole Microwire EEPROM is
+filled with a single WRAL instruction.
+
+Use --start-address and --length to fill only a range of bytes. I2C EEPROMs can
+only be filled without --length when the --chip is known.
+
+Microwire EEPROMs are write-enabled for the fill, and always write-disabled
+again afterwards. What was filled is read back to check it.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if fillPattern == "" {
+			errorMsg := "You must supply the --pattern flag."
+			return errors.New(errorMsg)
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := commandContext()
+		defer cancel()
+
+		prog := newProgrammer()
+		wordSize := prog.WordSize(programmer.IcType(icType))
+		value, err := strconv.ParseUint(fillPattern, 0, 8*wordSize)
+		if err != nil {
+			return fmt.Errorf("The pattern must be a %d bit word for %s EEPROMs, I.E. 0x%s. Error: %s", 8*wordSize, icType, bytes.Repeat([]byte("FF"), wordSize), err)
+		}
+		word := make([]byte, wordSize)
+		for i := range word {
+			word[wordSize-1-i] = byte(value >> (8 * uint(i)))
+		}
+
+		// A whole Microwire EEPROM is written at once, when the programmer
+		// can, and one word at a time otherwise
+		mc, canWriteAll := prog.(programmer.MicrowireController)
+		writeAll := canWriteAll && programmer.IcType(icType) == programmer.Microwire && fillLen == 0 && eepromAddr == 0
+		length := fillLen
+		if length == 0 {
+			length = eepromSize() - eepromAddr*wordSize
+		}
+		if length <= 0 {
+			errorMsg := "You must supply the --length flag, or the --chip flag."
+			return errors.New(errorMsg)
+		}
+		if err := checkChipRange(length); err != nil {
+			return err
+		}
+		if length%wordSize != 0 {
+			return fmt.Errorf("The length must be a multiple of %d bytes for %s EEPROMs", wordSize, icType)
+		}
+
+		if err := prog.Connect(ctx); err != nil {
+			return err
+		}
+		defer prog.Close()
+
+		// Sketches before protocol version 8 can not write every word at once,
+		// but write one word at a time just fine
+		if writeAll && !mc.CanControlMicrowire() {
+			writeAll = false
+		}
+		if writeAll {
+			err = mc.WriteAllMicrowire(ctx, word)
+		} else {
+			err = prog.Write(ctx, eepromAddr, bytes.Repeat(word, length/wordSize), programmer.IcType(icType))
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := checkFilled(ctx, prog, eepromAddr, length, word); err != nil {
+			return err
+		}
+		fmt.Printf("Filled %d bytes starting at address 0x%X with 0x%X.\n", length, eepromAddr, value)
+		return nil
+	},
+}
+
+func init() {
+	eepromCmd.AddCommand(fillCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// fillCmd.PersistentFlags().String("foo", "", "A help for foo")
+	fillCmd.Flags().StringVar(&fillPattern, "pattern", "", "The word to write to every address, I.E. 0xFFFF")
+	fillCmd.Flags().IntVar(&fillLen, "length", 0, "The number of bytes to fill, starting at --start-address. Default is the rest of the EEPROM")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	// fillCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+}
@@ -0,0 +1,67 @@
+// Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rgeyer/93l56r-cli/programmer"
+	"github.com/spf13/cobra"
+)
+
+// i2cScanCmd represents the i2c-scan command
+var i2cScanCmd = &cobra.Command{
+	Use:   "i2c-scan",
+	Short: "Lists the devices which respond on the I2C bus",
+	Long: `Probes every I2C device address from 0x08 to 0x77 through the Arduino, and
+lists the devices which respond. EEPROMs usually respond from 0x50, and parts
+with block select bits, like the 24C16, respond at several addresses.`,
+	// Overrides the eeprom command checks, since no --type is needed
+	PersistentPreRunE: checkSerialPort,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := commandContext()
+		defer cancel()
+
+		prog := newProgrammer()
+		scanner, ok := prog.(programmer.I2CScanner)
+		if !ok {
+			return errors.New("The i2c-scan command needs a programmer which can probe the I2C bus, which this one can not")
+		}
+		if err := prog.Connect(ctx); err != nil {
+			return err
+		}
+		defer prog.Close()
+
+		found, err := scanner.ScanI2C(ctx)
+		if err != nil {
+			return err
+		}
+		if len(found) == 0 {
+			fmt.Println("No devices responded on the I2C bus.")
+			return nil
+		}
+
+		fmt.Printf("%d devices responded on the I2C bus:\n", len(found))
+		for _, devAddr := range found {
+			fmt.Printf("0x%02X\n", devAddr)
+		}
+		return nil
+	},
+}
+
+func init() {
+	eepromCmd.AddCommand(i2cScanCmd)
+}
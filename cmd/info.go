@@ -0,0 +1,64 @@
+// Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// infoCmd represents the info command
+var infoCmd = &cobra.Command{
+	Use:   "info",
+	Short: "Shows the programmer firmware version and capabilities",
+	// Overrides the eeprom command checks, since no --type is needed
+	PersistentPreRunE: checkSerialPort,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := commandContext()
+		defer cancel()
+
+		prog := newProgrammer()
+		if err := prog.Connect(ctx); err != nil {
+			return err
+		}
+		defer prog.Close()
+
+		caps := prog.Capabilities()
+		firmware := caps.FirmwareVersion
+		if firmware == "" {
+			firmware = "unknown, the sketch predates the identify request"
+		}
+		icTypes := make([]string, len(caps.IcTypes))
+		for i, t := range caps.IcTypes {
+			icTypes[i] = string(t)
+		}
+		bauds := make([]string, len(caps.BaudRates))
+		for i, b := range caps.BaudRates {
+			bauds[i] = fmt.Sprint(b)
+		}
+
+		fmt.Printf("Firmware version: %s\n", firmware)
+		fmt.Printf("Buffer size:      %d bytes\n", caps.BufferSize)
+		fmt.Printf("EEPROM types:     %s\n", strings.Join(icTypes, ", "))
+		fmt.Printf("Baud rates:       %s\n", strings.Join(bauds, ", "))
+		return nil
+	},
+}
+
+func init() {
+	eepromCmd.AddCommand(infoCmd)
+}
@@ -15,73 +15,123 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io/ioutil"
+	"time"
 
+	"github.com/rgeyer/93l56r-cli/programmer"
 	"github.com/rgeyer/93l56r-cli/subaru/odometer"
 	"github.com/spf13/cobra"
 )
 
+var backupFile string
+
 // odometerCmd represents the odometer command
 var odometerCmd = &cobra.Command{
 	Use:   "odometer",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
-	Run: func(cmd *cobra.Command, args []string) {
-
-		// target_mileage := 157889
-		target_mileage := 116
-
-		fmt.Printf("Encoding value: %d ...\n", target_mileage)
-
-		data_buffer := odometer.Encode(target_mileage)
-
-		// repeat_count := target_mileage & 0x0F // Take lowest nibble and use it as the repeat count
-		// new_value := target_mileage >> 4      // The new count has that lowest nibble shaved off
-		// old_value := new_value - 1            // The old count will be new count - 1
-		//
-		// data_buffer := make([]byte, 0x20) // use this as a workspace
-		//
-		// encode_table := []byte{0x00, 0x07, 0x0C, 0x0B, 0x06, 0x01, 0x0A, 0x0D, 0x03, 0x04, 0x0F, 0x08, 0x05, 0x02, 0x09, 0x0E}
-		// // Encoding table for the least significant 4 bits..
-		// // as each value changes, 3 bits change and 1 stays the same. This is probably some wear leveling scheme for the EEPROM
-		//
-		// new_value = (new_value & 0xFFF0) + int(encode_table[new_value&0x0F]) // do encodings on both values
-		// old_value = (old_value & 0xFFF0) + int(encode_table[old_value&0x0F])
-		//
-		// data_buffer[0] = byte(new_value >> 8) // Store new_value in the first slot
-		// data_buffer[1] = byte(new_value & 0xFF)
-		//
-		// for count := 0; count < repeat_count; count++ { // Store new_value in more slots determined by repeat_count
-		// 	data_buffer[2+count*2] = byte(new_value >> 8)
-		// 	data_buffer[3+count*2] = byte(new_value & 0xFF)
-		// }
-		//
-		// for count := (1 + repeat_count); count < 16; count++ { // Fill in the remaining data with old_value
-		// 	data_buffer[0+count*2] = byte(old_value >> 8)
-		// 	data_buffer[1+count*2] = byte(old_value & 0xFF)
-		// }
-		//
-		// for count := 0; count < 8; count++ { // Invert bits in every other slot
-		// 	data_buffer[2+count*4] ^= 0xFF
-		// 	data_buffer[3+count*4] ^= 0xFF
-		// }
-
-		for line_count := 0; line_count < 2; line_count++ { // print the results on two lines
-			for byte_count := 0; byte_count < 0x10; byte_count++ {
-				fmt.Printf("0x%x ", data_buffer[byte_count+line_count*0x10])
+	Short: "Reads and writes the odometer stored in the combination meter",
+	Long: `Reads and writes the odometer stored in the right-vertical 93L56R EEPROM of the
+combination meter. The odometer is stored twice, in the 0x20 byte blocks at
+word addresses 0x60 and 0x70, which are the byte offsets 0xC0 and 0xE0 of a 256
+byte dump. The meter itself addresses them as 0xE0 and 0xF0, which the 93L56R
+maps to the same words since it ignores the top address bit.`,
+}
+
+// readOdometerBlocks reads both copies of the odometer from the combination
+// meter, in the order of odometer.Addresses.
+func readOdometerBlocks(ctx context.Context, prog programmer.Programmer) ([][]byte, error) {
+	var blocks [][]byte
+	for _, addr := range odometer.Addresses {
+		block, err := prog.Read(ctx, addr, odometer.BlockSize, programmer.Microwire)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// printOdometerCopies decodes and prints both copies of the odometer, and
+// whether they agree.
+func printOdometerCopies(blocks [][]byte) {
+	var mileages []int
+	var errs []error
+	for i, block := range blocks {
+		mileage, err := odometer.Decode(block)
+		mileages = append(mileages, mileage)
+		errs = append(errs, err)
+		if err != nil {
+			fmt.Printf("Odometer copy at 0x%X: %s\n", odometer.Addresses[i], err)
+			if err != odometer.ErrBlank {
+				printNearestMileage(block)
 			}
-			fmt.Print("\n\n")
+			continue
+		}
+		fmt.Printf("Odometer copy at 0x%X: %d\n", odometer.Addresses[i], mileage)
+	}
+
+	if errs[0] == nil && errs[1] == nil && mileages[0] == mileages[1] {
+		fmt.Println("Both copies agree.")
+	} else {
+		fmt.Println("The copies do NOT agree.")
+	}
+}
+
+// printNearestMileage prints the mileages closest to a corrupt block, which
+// are likely what the block held before it was damaged.
+func printNearestMileage(block []byte) {
+	recovery, err := odometer.DecodeNearest(block, odometer.MaxMileage)
+	if err != nil {
+		return
+	}
+	for _, match := range recovery.Matches {
+		fmt.Printf("  Nearest valid mileage is %d, %d bits differ (%s confidence)\n", match.Mileage, match.Distance, recovery.Confidence)
+	}
+}
+
+// writeOdometerCopies saves the original blocks to backupPath, writes mileage
+// to the copies at the given indexes of odometer.Addresses, and then reads
+// them back to confirm they decode to mileage. If backupPath is empty, the
+// backup is saved to odometer-backup-<timestamp>.bin. Nothing is saved or
+// written if mileage can not be encoded.
+func writeOdometerCopies(ctx context.Context, prog programmer.Programmer, original [][]byte, copies []int, mileage int, backupPath string) error {
+	buf, err := odometer.Encode(mileage)
+	if err != nil {
+		return err
+	}
+
+	if backupPath == "" {
+		backupPath = fmt.Sprintf("odometer-backup-%s.bin", time.Now().Format("20060102-150405"))
+	}
+	if err := ioutil.WriteFile(backupPath, bytes.Join(original, nil), 0644); err != nil {
+		return fmt.Errorf("Unable to save the odometer backup to file %s. Nothing was written. Error: %s", backupPath, err)
+	}
+	fmt.Printf("Saved the original odometer blocks to %s\n", backupPath)
+
+	for _, i := range copies {
+		if err := prog.Write(ctx, odometer.Addresses[i], buf, programmer.Microwire); err != nil {
+			return fmt.Errorf("Unable to write the odometer copy at 0x%X. Restore it from %s. Error: %s", odometer.Addresses[i], backupPath, err)
 		}
+	}
 
-		final_value := odometer.Decode(data_buffer)
+	blocks, err := readOdometerBlocks(ctx, prog)
+	if err != nil {
+		return err
+	}
+
+	for _, i := range copies {
+		written, err := odometer.Decode(blocks[i])
+		if err != nil {
+			return fmt.Errorf("The odometer copy at 0x%X could not be decoded after writing. Restore it from %s. Error: %s", odometer.Addresses[i], backupPath, err)
+		}
+		if written != mileage {
+			return fmt.Errorf("The odometer copy at 0x%X decodes to %d after writing, expected %d. Restore it from %s", odometer.Addresses[i], written, mileage, backupPath)
+		}
+	}
 
-		fmt.Printf("Result is %d\n", final_value)
-	},
+	return nil
 }
 
 func init() {
@@ -0,0 +1,69 @@
+// Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/rgeyer/93l56r-cli/subaru/odometer"
+	"github.com/spf13/cobra"
+)
+
+var dumpFile string
+
+// odometerDecodeCmd represents the odometer decode command
+var odometerDecodeCmd = &cobra.Command{
+	Use:   "decode",
+	Short: "Decodes both copies of the odometer from a dump of the right-vertical EEPROM",
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if dumpFile == "" {
+			errorMsg := "You must supply the --file flag."
+			return errors.New(errorMsg)
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		image, err := ioutil.ReadFile(dumpFile)
+		if err != nil {
+			return fmt.Errorf("Unable to read the EEPROM dump %s. Error: %s", dumpFile, err)
+		}
+
+		blocks, err := odometer.ImageBlocks(image)
+		if err != nil {
+			return err
+		}
+
+		printOdometerCopies(blocks)
+
+		return nil
+	},
+}
+
+func init() {
+	odometerCmd.AddCommand(odometerDecodeCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// odometerDecodeCmd.PersistentFlags().String("foo", "", "A help for foo")
+	odometerDecodeCmd.Flags().StringVar(&dumpFile, "file", "", "A dump of the right-vertical EEPROM, like the ones created by eeprom read")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	// odometerDecodeCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+}
@@ -0,0 +1,101 @@
+// Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/rgeyer/93l56r-cli/subaru/odometer"
+	"github.com/spf13/cobra"
+)
+
+var patchedFile string
+
+// odometerPatchCmd represents the odometer patch command
+var odometerPatchCmd = &cobra.Command{
+	Use:   "patch",
+	Short: "Sets the odometer in a dump of the right-vertical EEPROM to the --mileage",
+	Long: `Sets both copies of the odometer in a dump of the right-vertical EEPROM to the
+--mileage, and saves the result to the --out file. The rest of the dump is left
+untouched, and the --file itself is not modified.
+
+The result can be flashed to the combination meter with eeprom write.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if dumpFile == "" {
+			errorMsg := "You must supply the --file flag."
+			return errors.New(errorMsg)
+		}
+		if patchedFile == "" {
+			errorMsg := "You must supply the --out flag."
+			return errors.New(errorMsg)
+		}
+		if !cmd.Flags().Changed("mileage") {
+			errorMsg := "You must supply the --mileage flag."
+			return errors.New(errorMsg)
+		}
+		if mileage < 0 || mileage > odometer.MaxMileage {
+			return fmt.Errorf("The --mileage must be between 0 and %d", odometer.MaxMileage)
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		image, err := ioutil.ReadFile(dumpFile)
+		if err != nil {
+			return fmt.Errorf("Unable to read the EEPROM dump %s. Error: %s", dumpFile, err)
+		}
+
+		blocks, err := odometer.ImageBlocks(image)
+		if err != nil {
+			return err
+		}
+
+		for i, block := range blocks {
+			if was, err := odometer.Decode(block); err != nil {
+				fmt.Printf("Odometer copy at 0x%X was unreadable. %s\n", odometer.Addresses[i], err)
+			} else {
+				fmt.Printf("Odometer copy at 0x%X was %d\n", odometer.Addresses[i], was)
+			}
+		}
+		if err := odometer.PatchImage(image, mileage); err != nil {
+			return err
+		}
+
+		if err := ioutil.WriteFile(patchedFile, image, 0644); err != nil {
+			return fmt.Errorf("Unable to save the patched EEPROM dump to file %s. Error: %s", patchedFile, err)
+		}
+		fmt.Printf("Set the odometer to %d and saved the patched dump to %s\n", mileage, patchedFile)
+
+		return nil
+	},
+}
+
+func init() {
+	odometerCmd.AddCommand(odometerPatchCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// odometerPatchCmd.PersistentFlags().String("foo", "", "A help for foo")
+	odometerPatchCmd.Flags().StringVar(&dumpFile, "file", "", "A dump of the right-vertical EEPROM, like the ones created by eeprom read")
+	odometerPatchCmd.Flags().StringVar(&patchedFile, "out", "", "A file to save the patched dump to")
+	odometerPatchCmd.Flags().IntVar(&mileage, "mileage", 0, "The mileage to set the odometer to. Between 0 and 999999")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	// odometerPatchCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+}
@@ -0,0 +1,67 @@
+// Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+
+	"github.com/spf13/cobra"
+)
+
+// odometerReadCmd represents the odometer read command
+var odometerReadCmd = &cobra.Command{
+	Use:   "read",
+	Short: "Reads and decodes both copies of the odometer from the combination meter",
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if serPort == "" {
+			errorMsg := "You must supply the --serial-port flag."
+			return errors.New(errorMsg)
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := commandContext()
+		defer cancel()
+
+		prog := newProgrammer()
+		if err := prog.Connect(ctx); err != nil {
+			return err
+		}
+		defer prog.Close()
+
+		blocks, err := readOdometerBlocks(ctx, prog)
+		if err != nil {
+			return err
+		}
+
+		printOdometerCopies(blocks)
+
+		return nil
+	},
+}
+
+func init() {
+	odometerCmd.AddCommand(odometerReadCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// odometerReadCmd.PersistentFlags().String("foo", "", "A help for foo")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	// odometerReadCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+}
@@ -0,0 +1,137 @@
+// Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rgeyer/93l56r-cli/subaru/odometer"
+	"github.com/spf13/cobra"
+)
+
+// odometerRepairCmd represents the odometer repair command
+var odometerRepairCmd = &cobra.Command{
+	Use:   "repair",
+	Short: "Repairs the odometer when the two copies in the combination meter disagree",
+	Long: `Reads both copies of the odometer from the combination meter, shows which copy
+is valid and which is blank or corrupt, and rewrites the bad copy from the good
+one.
+
+When both copies are bad, or both are valid but disagree, supply the --mileage to
+write to the copies which do not hold it. The --mileage may also be supplied to
+override the good copy.
+
+Before anything is written, both copies are saved to the --backup-file.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if serPort == "" {
+			errorMsg := "You must supply the --serial-port flag."
+			return errors.New(errorMsg)
+		}
+		if cmd.Flags().Changed("mileage") && (mileage < 0 || mileage > odometer.MaxMileage) {
+			return fmt.Errorf("The --mileage must be between 0 and %d", odometer.MaxMileage)
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := commandContext()
+		defer cancel()
+
+		prog := newProgrammer()
+		if err := prog.Connect(ctx); err != nil {
+			return err
+		}
+		defer prog.Close()
+
+		blocks, err := readOdometerBlocks(ctx, prog)
+		if err != nil {
+			return err
+		}
+
+		var mileages []int
+		var isValid []bool
+		var valid []int
+		for i, block := range blocks {
+			m, err := odometer.Decode(block)
+			mileages = append(mileages, m)
+			isValid = append(isValid, err == nil)
+			switch {
+			case err == odometer.ErrBlank:
+				fmt.Printf("Odometer copy at 0x%X is blank\n", odometer.Addresses[i])
+			case err != nil:
+				fmt.Printf("Odometer copy at 0x%X is corrupt. %s\n", odometer.Addresses[i], err)
+				printNearestMileage(block)
+			default:
+				fmt.Printf("Odometer copy at 0x%X is valid, and holds %d\n", odometer.Addresses[i], m)
+				valid = append(valid, i)
+			}
+		}
+
+		target := mileage
+		if !cmd.Flags().Changed("mileage") {
+			switch {
+			case len(valid) == 0:
+				return errors.New("Neither copy of the odometer is valid. Supply the --mileage to write to both copies")
+			case len(valid) == 2 && mileages[0] == mileages[1]:
+				fmt.Println("Both copies are valid and agree. Nothing to repair.")
+				return nil
+			case len(valid) == 2:
+				return fmt.Errorf("Both copies of the odometer are valid, but they disagree (%d and %d). Supply the --mileage to write to the copy which is wrong", mileages[0], mileages[1])
+			}
+			target = mileages[valid[0]]
+		}
+		if target > odometer.MaxMileage {
+			return fmt.Errorf("The valid copy of the odometer holds %d, which is more than the %d the odometer can display. Supply the --mileage to write to both copies", target, odometer.MaxMileage)
+		}
+
+		var rewrite []int
+		for i := range blocks {
+			if !isValid[i] || mileages[i] != target {
+				rewrite = append(rewrite, i)
+			}
+		}
+		if len(rewrite) == 0 {
+			fmt.Printf("Both copies already hold %d. Nothing to repair.\n", target)
+			return nil
+		}
+
+		for _, i := range rewrite {
+			fmt.Printf("Rewriting the odometer copy at 0x%X with %d\n", odometer.Addresses[i], target)
+		}
+		if err := writeOdometerCopies(ctx, prog, blocks, rewrite, target, backupFile); err != nil {
+			return err
+		}
+
+		fmt.Printf("Successfully repaired the odometer. Both copies hold %d\n", target)
+
+		return nil
+	},
+}
+
+func init() {
+	odometerCmd.AddCommand(odometerRepairCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// odometerRepairCmd.PersistentFlags().String("foo", "", "A help for foo")
+	odometerRepairCmd.Flags().IntVar(&mileage, "mileage", 0, "The mileage to write to the copies which do not hold it. Between 0 and 999999. Default is the mileage of the valid copy")
+	odometerRepairCmd.Flags().StringVar(&backupFile, "backup-file", "", "A file to save the original odometer blocks to. Default is odometer-backup-<timestamp>.bin")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	// odometerRepairCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+}
@@ -0,0 +1,89 @@
+// Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rgeyer/93l56r-cli/subaru/odometer"
+	"github.com/spf13/cobra"
+)
+
+var mileage int
+
+// odometerWriteCmd represents the odometer write command
+var odometerWriteCmd = &cobra.Command{
+	Use:   "write",
+	Short: "Writes the --mileage to both copies of the odometer in the combination meter",
+	Long: `Writes the --mileage to both copies of the odometer in the combination meter.
+
+Before anything is written, both copies are read and saved to the --backup-file,
+one after the other. After writing, both copies are read back and decoded to
+confirm they hold the new mileage.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if serPort == "" {
+			errorMsg := "You must supply the --serial-port flag."
+			return errors.New(errorMsg)
+		}
+		if !cmd.Flags().Changed("mileage") {
+			errorMsg := "You must supply the --mileage flag."
+			return errors.New(errorMsg)
+		}
+		if mileage < 0 || mileage > odometer.MaxMileage {
+			return fmt.Errorf("The --mileage must be between 0 and %d", odometer.MaxMileage)
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := commandContext()
+		defer cancel()
+
+		prog := newProgrammer()
+		if err := prog.Connect(ctx); err != nil {
+			return err
+		}
+		defer prog.Close()
+
+		blocks, err := readOdometerBlocks(ctx, prog)
+		if err != nil {
+			return err
+		}
+
+		if err := writeOdometerCopies(ctx, prog, blocks, []int{0, 1}, mileage, backupFile); err != nil {
+			return err
+		}
+
+		fmt.Printf("Successfully set the odometer to %d\n", mileage)
+
+		return nil
+	},
+}
+
+func init() {
+	odometerCmd.AddCommand(odometerWriteCmd)
+
+	// Here you will define your flags and configuration settings.
+
+	// Cobra supports Persistent Flags which will work for this command
+	// and all subcommands, e.g.:
+	// odometerWriteCmd.PersistentFlags().String("foo", "", "A help for foo")
+	odometerWriteCmd.Flags().IntVar(&mileage, "mileage", 0, "The mileage to write to the odometer. Between 0 and 999999")
+	odometerWriteCmd.Flags().StringVar(&backupFile, "backup-file", "", "A file to save the original odometer blocks to. Default is odometer-backup-<timestamp>.bin")
+
+	// Cobra supports local flags which will only run when this command
+	// is called directly, e.g.:
+	// odometerWriteCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+}
@@ -0,0 +1,64 @@
+// Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rgeyer/93l56r-cli/programmer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// portsCmd represents the ports command
+var portsCmd = &cobra.Command{
+	Use:   "ports",
+	Short: "Lists the serial ports a programmer may be connected to, and probes each of them",
+	Long: `Lists the serial ports a programmer may be connected to, and probes each of
+them with the reset handshake, reporting the firmware of any programmer which
+responds. These are the ports searched by --serial-port auto.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := commandContext()
+		defer cancel()
+
+		results, err := programmer.ProbePorts(ctx, viper.GetDuration("response-timeout"))
+		if err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			fmt.Println("No candidate serial ports found.")
+			return nil
+		}
+
+		fmt.Println()
+		for _, result := range results {
+			if result.Err != nil {
+				fmt.Printf("%s: no programmer. %s\n", result.Port, strings.SplitN(result.Err.Error(), "\n", 2)[0])
+				continue
+			}
+			firmware := result.Capabilities.FirmwareVersion
+			if firmware == "" {
+				firmware = "unknown"
+			}
+			fmt.Printf("%s: programmer firmware %s, protocol version %d, supports %v EEPROMs\n", result.Port, firmware, result.ProtocolVersion, result.Capabilities.IcTypes)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(portsCmd)
+}
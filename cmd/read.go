@@ -19,12 +19,16 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"time"
 
+	"github.com/rgeyer/93l56r-cli/programmer"
 	"github.com/spf13/cobra"
 )
 
 var outFile string
 var binLen int
+var resume bool
 
 // readCmd represents the read command
 var readCmd = &cobra.Command{
@@ -39,23 +43,60 @@ var readCmd = &cobra.Command{
 	},
 
 	RunE: func(cmd *cobra.Command, args []string) error {
-		buf := make([]byte, binLen)
-		var err error
-		arduino := NewArduino93L56R(serPort)
-		if err := arduino.Connect(); err != nil {
+		if chip != nil && !cmd.Flags().Changed("read-length") {
+			binLen = chip.Size - eepromAddr*chip.WordSize
+		}
+		if err := checkChipRange(binLen); err != nil {
 			return err
 		}
-		defer arduino.Close()
 
-		buf, err = arduino.Read(eepromAddr, binLen, icType)
-		if err != nil {
+		ctx, cancel := commandContext()
+		defer cancel()
+
+		prog := newProgrammer()
+		wordSize := prog.WordSize(programmer.IcType(icType))
+
+		// Whatever was saved by an earlier, interrupted, read is kept and
+		// continued from
+		var saved []byte
+		if resume {
+			existing, err := ioutil.ReadFile(outFile)
+			if err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("Unable to read the partially saved file %s. Error: %s", outFile, err)
+			}
+			saved = existing[:len(existing)/wordSize*wordSize]
+			if len(saved) >= binLen {
+				fmt.Printf("All %d bytes have already been saved to %s.\n", binLen, outFile)
+				return nil
+			}
+			if len(saved) > 0 {
+				fmt.Printf("Resuming after the %d bytes already saved to %s.\n", len(saved), outFile)
+			}
+		}
+		startAddr := eepromAddr + len(saved)/wordSize
+
+		if err := prog.Connect(ctx); err != nil {
 			return err
 		}
+		defer prog.Close()
+
+		start := time.Now()
+		buf, readErr := prog.Read(ctx, startAddr, binLen-len(saved), programmer.IcType(icType))
+		if perr, ok := readErr.(*programmer.PartialReadError); ok {
+			buf = perr.Data
+		} else if readErr != nil {
+			return readErr
+		}
+		buf = append(saved, buf...)
 
-		err = ioutil.WriteFile(outFile, buf, 0644)
+		err := ioutil.WriteFile(outFile, buf, 0644)
 		if err != nil {
 			return fmt.Errorf("Unable to save EEPROM contents to file %s. Error: %s", outFile, err)
 		}
+		if readErr != nil {
+			return fmt.Errorf("%s\n\nSaved the %d bytes read so far to %s. Run the same command with --resume to continue.", readErr, len(buf), outFile)
+		}
+		fmt.Printf("Read %s.\n", throughput(prog, len(buf)-len(saved), time.Since(start)))
 
 		fmt.Println(hex.Dump(buf))
 
@@ -72,7 +113,8 @@ func init() {
 	// and all subcommands, e.g.:
 	// readCmd.PersistentFlags().String("foo", "", "A help for foo")
 	readCmd.Flags().StringVar(&outFile, "output-file", "", "A file to store the contents read from the EEPROM")
-	readCmd.Flags().IntVar(&binLen, "read-length", 256, "The number of bytes to read from the EEPROM. Default is 256")
+	readCmd.Flags().IntVar(&binLen, "read-length", 256, "The number of bytes to read from the EEPROM. Default is 256, or the rest of the --chip")
+	readCmd.Flags().BoolVar(&resume, "resume", false, "Continue a read which was interrupted, keeping what was already saved to the --output-file")
 
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
@@ -15,10 +15,13 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 
 	homedir "github.com/mitchellh/go-homedir"
+	"github.com/rgeyer/93l56r-cli/programmer"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -57,6 +60,10 @@ func init() {
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.93l56r-cli.yaml)")
+	rootCmd.PersistentFlags().Duration("timeout", 0, "How long the whole operation may take before it is stopped. I.E. 30s, or 0 for no limit")
+	rootCmd.PersistentFlags().Duration("response-timeout", programmer.DefaultResponseTimeout, "How long to wait for the programmer to respond to each request")
+	viper.BindPFlag("timeout", rootCmd.PersistentFlags().Lookup("timeout"))
+	viper.BindPFlag("response-timeout", rootCmd.PersistentFlags().Lookup("response-timeout"))
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -88,3 +95,26 @@ func initConfig() {
 		fmt.Println("Using config file:", viper.ConfigFileUsed())
 	}
 }
+
+// commandContext returns the context for the programmer operations of a
+// command. It is cancelled when the user presses Ctrl-C, and once the
+// --timeout passes, if there is one. Cancelling it also ends the line of a
+// progress bar left open by an operation which was stopped, before any error
+// is printed.
+func commandContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	timeout := viper.GetDuration("timeout")
+	if timeout <= 0 {
+		return ctx, func() {
+			stop()
+			endProgress()
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+		endProgress()
+	}
+}
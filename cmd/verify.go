@@ -15,29 +15,162 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"time"
 
+	"github.com/rgeyer/93l56r-cli/programmer"
 	"github.com/spf13/cobra"
 )
 
+var verifyLen int
+
+// mismatch is a single EEPROM word which differs from the expected content.
+type mismatch struct {
+	addr     int
+	expected int
+	actual   int
+}
+
 // verifyCmd represents the verify command
 var verifyCmd = &cobra.Command{
 	Use:   "verify",
-	Short: "Not implemented. Ultimately will compare the EEPROM contents with a file.",
-	RunE: func(cmd *cobra.Command, args []string) error {
-		fmt.Println("Not implemented")
+	Short: "Compares the EEPROM contents with the --input-file",
+	Long: `Compares the EEPROM contents with the --input-file, which is expected to be a
+dump of the whole EEPROM, like the ones created by the read command.
+
+Use --start-address and --length to verify only a single region of the EEPROM,
+for example the odometer. The region is compared against the same offset in the
+--input-file. Every word which differs is listed, and the command exits with a
+non-zero status if there are any differences.
+
+For example:
+
+  93l56r-cli eeprom verify --serial-port auto --type microwire --input-file dump.bin`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if inFile == "" {
+			errorMsg := "You must supply the --input-file flag."
+			return errors.New(errorMsg)
+		}
 		return nil
 	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// A mismatch is an expected outcome rather than a usage error, and
+		// Execute prints it
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+
+		prog := newProgrammer()
+		wordSize := prog.WordSize(programmer.IcType(icType))
+
+		buf, err := ioutil.ReadFile(inFile)
+		if err != nil {
+			return fmt.Errorf("Unable to read the input file %s. Error: %s", inFile, err)
+		}
+
+		expected, err := verifyRegion(buf, eepromAddr, verifyLen, wordSize)
+		if err != nil {
+			return err
+		}
+		length := len(expected)
+		if err := checkChipRange(length); err != nil {
+			return err
+		}
+
+		ctx, cancel := commandContext()
+		defer cancel()
+
+		if err := prog.Connect(ctx); err != nil {
+			return err
+		}
+		defer prog.Close()
+
+		start := time.Now()
+		actual, err := prog.Read(ctx, eepromAddr, length, programmer.IcType(icType))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Read %s.\n", throughput(prog, len(actual), time.Since(start)))
+
+		mismatches := compareWords(eepromAddr, expected, actual, wordSize)
+		if len(mismatches) == 0 {
+			fmt.Printf("EEPROM matches %s. Verified %d bytes starting at address 0x%X.\n", inFile, length, eepromAddr)
+			return nil
+		}
+
+		valueFmt := fmt.Sprintf("0x%%0%dX", wordSize*2)
+		for _, m := range mismatches {
+			fmt.Printf("0x%04X: expected "+valueFmt+", got "+valueFmt+"\n", m.addr, m.expected, m.actual)
+		}
+		return fmt.Errorf("EEPROM does not match %s. %d of %d words differ", inFile, len(mismatches), length/wordSize)
+	},
+}
+
+// verifyAliasCmd keeps the top level verify command working, now that it is
+// eeprom verify
+var verifyAliasCmd = &cobra.Command{
+	Use:                "verify",
+	Short:              "Alias for eeprom verify",
+	Long:               `Alias for eeprom verify, which takes the same flags. See 93l56r-cli eeprom verify --help`,
+	DisableFlagParsing: true,
+	SilenceUsage:       true,
+	SilenceErrors:      true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rootCmd.SetArgs(append([]string{"eeprom", "verify"}, args...))
+		return rootCmd.Execute()
+	},
+}
+
+// verifyRegion returns the region of the input file buf to verify, which
+// starts at the word address addr and is length bytes long, or runs to the end
+// of buf if length is 0.
+func verifyRegion(buf []byte, addr int, length int, wordSize int) ([]byte, error) {
+	offset := addr * wordSize
+	if addr < 0 || offset >= len(buf) {
+		return nil, fmt.Errorf("The start address 0x%X is beyond the end of the input file %s, which is %d bytes long", addr, inFile, len(buf))
+	}
+	if length == 0 {
+		length = len(buf) - offset
+	}
+	if length < 0 || length%wordSize != 0 {
+		return nil, fmt.Errorf("The length must be a multiple of %d bytes for %s EEPROMs", wordSize, icType)
+	}
+	if offset+length > len(buf) {
+		return nil, fmt.Errorf("The region to verify runs past the end of the input file %s, which is %d bytes long", inFile, len(buf))
+	}
+	return buf[offset : offset+length], nil
+}
+
+// compareWords compares expected and actual one word of wordSize bytes at a
+// time, and returns every word which differs. startAddr is the EEPROM address
+// of the first word.
+func compareWords(startAddr int, expected []byte, actual []byte, wordSize int) []mismatch {
+	var mismatches []mismatch
+	for i := 0; i+wordSize <= len(expected) && i+wordSize <= len(actual); i += wordSize {
+		e, a := 0, 0
+		for b := 0; b < wordSize; b++ {
+			e = e<<8 | int(expected[i+b])
+			a = a<<8 | int(actual[i+b])
+		}
+		if e != a {
+			mismatches = append(mismatches, mismatch{addr: startAddr + i/wordSize, expected: e, actual: a})
+		}
+	}
+	return mismatches
 }
 
 func init() {
-	rootCmd.AddCommand(verifyCmd)
+	eepromCmd.AddCommand(verifyCmd)
+	rootCmd.AddCommand(verifyAliasCmd)
 
 	// Here you will define your flags and configuration settings.
 
 	// Cobra supports Persistent Flags which will work for this command
 	// and all subcommands, e.g.:
 	// verifyCmd.PersistentFlags().String("foo", "", "A help for foo")
+	verifyCmd.Flags().StringVar(&inFile, "input-file", "", "A dump of the whole EEPROM to compare the EEPROM contents with")
+	verifyCmd.Flags().IntVar(&verifyLen, "length", 0, "The number of bytes to verify, starting at --start-address. Default is the rest of the --input-file")
 
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
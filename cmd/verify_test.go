@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompareWords(t *testing.T) {
+	cases := []struct {
+		name      string
+		startAddr int
+		expected  []byte
+		actual    []byte
+		wordSize  int
+		result    []mismatch
+	}{
+		{"x16 equal", 0, []byte{0x12, 0x34, 0x56, 0x78}, []byte{0x12, 0x34, 0x56, 0x78}, 2, nil},
+		{"x16 one word", 0x70, []byte{0x12, 0x34, 0x56, 0x78}, []byte{0x12, 0x34, 0x56, 0x79}, 2, []mismatch{{0x71, 0x5678, 0x5679}}},
+		{"x16 both bytes of a word", 0, []byte{0x12, 0x34}, []byte{0xFF, 0xFF}, 2, []mismatch{{0, 0x1234, 0xFFFF}}},
+		{"x8 every byte", 0x10, []byte{0x01, 0x02}, []byte{0x03, 0x04}, 1, []mismatch{{0x10, 0x01, 0x03}, {0x11, 0x02, 0x04}}},
+		{"x8 equal", 0, []byte{0xAB}, []byte{0xAB}, 1, nil},
+		{"short actual", 0, []byte{0x12, 0x34, 0x56, 0x78}, []byte{0x12, 0x35}, 2, []mismatch{{0, 0x1234, 0x1235}}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result := compareWords(c.startAddr, c.expected, c.actual, c.wordSize)
+			if !reflect.DeepEqual(result, c.result) {
+				t.Fatalf("Expected %+v, got %+v", c.result, result)
+			}
+		})
+	}
+}
+
+func TestVerifyRegion(t *testing.T) {
+	buf := make([]byte, 256)
+	for i := range buf {
+		buf[i] = byte(i)
+	}
+
+	cases := []struct {
+		name      string
+		addr      int
+		length    int
+		wordSize  int
+		offset    int
+		expectLen int
+		expectErr bool
+	}{
+		{"whole file", 0, 0, 2, 0, 256, false},
+		{"x16 rest of file", 0x60, 0, 2, 0xC0, 0x40, false},
+		{"x16 region", 0x60, 0x20, 2, 0xC0, 0x20, false},
+		{"x8 region", 0x60, 0x20, 1, 0x60, 0x20, false},
+		{"start past the end", 0x80, 0, 2, 0, 0, true},
+		{"negative start", -1, 0, 1, 0, 0, true},
+		{"odd length", 0, 3, 2, 0, 0, true},
+		{"runs past the end", 0x70, 0x40, 2, 0, 0, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			region, err := verifyRegion(buf, c.addr, c.length, c.wordSize)
+			if c.expectErr {
+				if err == nil {
+					t.Fatal("Expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(region) != c.expectLen || region[0] != byte(c.offset) {
+				t.Fatalf("Expected %d bytes from 0x%X, got %d bytes from 0x%X", c.expectLen, c.offset, len(region), region[0])
+			}
+		})
+	}
+}
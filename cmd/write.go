@@ -22,6 +22,7 @@ import (
 	"reflect"
 	"time"
 
+	"github.com/rgeyer/93l56r-cli/programmer"
 	"github.com/spf13/cobra"
 )
 
@@ -39,49 +40,34 @@ var writeCmd = &cobra.Command{
 		return nil
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		var maxPacketDataLen int
-		var wordSizeScale int
-
-		if icType == "microwire" {
-			maxPacketDataLen = 56
-			// maxPacketDataLen = 10
-			wordSizeScale = 2
-		}
-		if icType == "i2c" {
-			maxPacketDataLen = 55
-			wordSizeScale = 1
-		}
 		// TODO: Require a --force option to write without reading
 		buf, err := ioutil.ReadFile(inFile)
 		if err != nil {
 			return fmt.Errorf("Unable to read the input file %s. Error: %s", inFile, err)
 		}
-
-		arduino := NewArduino93L56R(serPort)
-		if err := arduino.Connect(); err != nil {
+		if err := checkChipRange(len(buf)); err != nil {
 			return err
 		}
-		defer arduino.Close()
 
-		start := time.Now()
+		ctx, cancel := commandContext()
+		defer cancel()
 
-		wholePacketCount := len(buf) / maxPacketDataLen
-		for l := 0; l < wholePacketCount; l++ {
-			startAddr := maxPacketDataLen/wordSizeScale*l + eepromAddr
-			bufslice := buf[startAddr*wordSizeScale : startAddr*wordSizeScale+maxPacketDataLen]
-			if err = arduino.Write(startAddr, bufslice, icType); err != nil {
-				return err
-			}
+		prog := newProgrammer()
+		if err := prog.Connect(ctx); err != nil {
+			return err
 		}
+		defer prog.Close()
+
+		start := time.Now()
 
-		remainder := buf[wholePacketCount*maxPacketDataLen:]
-		if err = arduino.Write(maxPacketDataLen/wordSizeScale*wholePacketCount+eepromAddr, remainder, icType); err != nil {
+		// The programmer splits the file into as many packets as it needs
+		if err = prog.Write(ctx, eepromAddr, buf, programmer.IcType(icType)); err != nil {
 			return err
 		}
 
 		duration := time.Since(start)
 
-		ver, err := arduino.Read(eepromAddr, len(buf), icType)
+		ver, err := prog.Read(ctx, eepromAddr, len(buf), programmer.IcType(icType))
 		if err != nil {
 			return err
 		}
@@ -89,7 +75,7 @@ var writeCmd = &cobra.Command{
 		if !reflect.DeepEqual(ver, buf) {
 			return fmt.Errorf("The content written to the EEPROM was not the same as the content of the supplied file after writing.\n\nFile:\n%s\n\nEEPROM Content:\n%s", hex.Dump(buf), hex.Dump(ver))
 		} else {
-			fmt.Printf("Successfully wrote file to EEPROM in %s.\n\n%s", duration, hex.Dump(ver))
+			fmt.Printf("Successfully wrote file to EEPROM, %s.\n\n%s", throughput(prog, len(buf), duration), hex.Dump(ver))
 		}
 
 		return nil
@@ -0,0 +1,56 @@
+// Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// writeDisableCmd represents the write-disable command
+var writeDisableCmd = &cobra.Command{
+	Use:   "write-disable",
+	Short: "Write-disables a Microwire EEPROM with the EWDS instruction",
+	Long: `Sends the EWDS instruction, which protects a Microwire EEPROM from spurious
+writes, I.E. while the module it is soldered to is powered up in circuit.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return checkMicrowire(cmd)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := commandContext()
+		defer cancel()
+
+		prog := newProgrammer()
+		mc, err := microwireController(cmd, prog)
+		if err != nil {
+			return err
+		}
+		if err := prog.Connect(ctx); err != nil {
+			return err
+		}
+		defer prog.Close()
+
+		if err := mc.WriteEnableMicrowire(ctx, false); err != nil {
+			return err
+		}
+		fmt.Println("The EEPROM is now write-disabled.")
+		return nil
+	},
+}
+
+func init() {
+	eepromCmd.AddCommand(writeDisableCmd)
+}
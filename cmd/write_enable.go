@@ -0,0 +1,58 @@
+// Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// writeEnableCmd represents the write-enable command
+var writeEnableCmd = &cobra.Command{
+	Use:   "write-enable",
+	Short: "Write-enables a Microwire EEPROM with the EWEN instruction",
+	Long: `Sends the EWEN instruction, which leaves a Microwire EEPROM write-enabled until
+the write-disable command is run, or it is powered off. Every other command
+leaves the EEPROM write-disabled, so this is only needed to write to it with
+another tool.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return checkMicrowire(cmd)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := commandContext()
+		defer cancel()
+
+		prog := newProgrammer()
+		mc, err := microwireController(cmd, prog)
+		if err != nil {
+			return err
+		}
+		if err := prog.Connect(ctx); err != nil {
+			return err
+		}
+		defer prog.Close()
+
+		if err := mc.WriteEnableMicrowire(ctx, true); err != nil {
+			return err
+		}
+		fmt.Println("The EEPROM is now write-enabled. Run the write-disable command once done.")
+		return nil
+	},
+}
+
+func init() {
+	eepromCmd.AddCommand(writeEnableCmd)
+}
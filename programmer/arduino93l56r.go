@@ -0,0 +1,427 @@
+package programmer
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jacobsa/go-serial/serial"
+	"github.com/rgeyer/93l56r-cli/programmer/protocol"
+)
+
+// Arduino93L56R is a Programmer backed by an Arduino running the subaru immo
+// sketch, connected via a serial port.
+type Arduino93L56R struct {
+	serialOpts serial.OpenOptions
+	serial     io.ReadWriteCloser
+	reader     *bufio.Reader
+	partial    []byte
+	protocol   int
+	seq        byte
+	caps       Capabilities
+	wrap       func(io.ReadWriteCloser) io.ReadWriteCloser
+	sim        *simulatedSerial
+
+	responseTimeout time.Duration
+	// baud is the rate to switch to once connected
+	baud     int
+	progress func(done, total int)
+
+	i2cAddress         byte
+	i2cAddressBytes    int
+	i2cBlockSelectBits int
+	i2cPageSize        int
+
+	microwireOrganization int
+	microwireAddressBits  int
+}
+
+// NewArduino93L56R returns an Arduino93L56R which will connect to the Arduino
+// on serPort. If serPort starts with sim:// the remainder is treated as the
+// path to an EEPROM image, and a simulated Arduino is used instead. If it is
+// AutoPort, Connect finds the Arduino with FindProgrammer.
+func NewArduino93L56R(serPort string) *Arduino93L56R {
+	return &Arduino93L56R{
+		serialOpts: serial.OpenOptions{
+			PortName:              serPort,
+			BaudRate:              DefaultBaudRate,
+			DataBits:              8,
+			StopBits:              1,
+			InterCharacterTimeout: 200,
+			MinimumReadSize:       0,
+			ParityMode:            serial.PARITY_NONE,
+		},
+		responseTimeout: DefaultResponseTimeout,
+		baud:            DefaultBaudRate,
+		i2cAddress:      DefaultI2CAddress,
+		i2cAddressBytes: 1,
+
+		microwireOrganization: DefaultMicrowireOrganization,
+		microwireAddressBits:  DefaultMicrowireAddressBits,
+	}
+}
+
+// SetResponseTimeout sets how long to wait for the Arduino to respond to each
+// request before giving up on it, or retransmitting it.
+func (a *Arduino93L56R) SetResponseTimeout(timeout time.Duration) {
+	a.responseTimeout = timeout
+}
+
+// SetProgress makes Read and Write call progress when they start, and after
+// every request, with the number of bytes done so far, and the total.
+func (a *Arduino93L56R) SetProgress(progress func(done, total int)) {
+	a.progress = progress
+}
+
+func (a *Arduino93L56R) reportProgress(done, total int) {
+	if a.progress != nil {
+		a.progress(done, total)
+	}
+}
+
+// WrapTransport makes Connect pass the serial connection it opens through
+// wrap, and talk to the Arduino through whatever wrap returns instead. I.E. a
+// FaultyTransport.
+func (a *Arduino93L56R) WrapTransport(wrap func(io.ReadWriteCloser) io.ReadWriteCloser) {
+	a.wrap = wrap
+}
+
+// Connect opens the serial port and resets the Arduino, offering it the newest
+// ProtocolVersion. Sketches which predate protocol versions acknowledge the
+// reset without one, and are spoken to using version 1. From version 4 the
+// sketch is then asked for its Capabilities.
+//
+// Every sketch starts at DefaultBaudRate. If SetBaudRate asked for another
+// rate, the sketch is then switched to it, see switchBaud.
+func (a *Arduino93L56R) Connect(ctx context.Context) error {
+	var err error
+	if a.serialOpts.PortName == AutoPort {
+		if a.serialOpts.PortName, err = FindProgrammer(ctx, a.responseTimeout); err != nil {
+			return err
+		}
+	}
+
+	if err := a.open(DefaultBaudRate); err != nil {
+		return err
+	}
+	if err := a.handshake(ctx, resetAttempts); err != nil {
+		// Otherwise every port probed without a programmer stays open
+		a.Close()
+		return err
+	}
+	if a.baud == DefaultBaudRate {
+		return nil
+	}
+	if err := a.switchBaud(ctx, a.baud); err != nil {
+		a.Close()
+		return err
+	}
+	return nil
+}
+
+// open opens the serial port at baud, closing it first if it is already open.
+// Simulated Arduinos are kept across reopening, like a real one would be.
+func (a *Arduino93L56R) open(baud int) error {
+	a.Close()
+	a.serialOpts.BaudRate = uint(baud)
+
+	var ser io.ReadWriteCloser
+	var err error
+	if strings.HasPrefix(a.serialOpts.PortName, simulatedPortPrefix) {
+		if a.sim == nil {
+			a.sim, err = newSimulatedSerial(strings.TrimPrefix(a.serialOpts.PortName, simulatedPortPrefix))
+		}
+		if a.sim != nil {
+			a.sim.open(baud)
+		}
+		ser = a.sim
+	} else {
+		ser, err = serial.Open(a.serialOpts)
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to open Serial Port: %s", err)
+	}
+	if a.wrap != nil {
+		ser = a.wrap(ser)
+	}
+	a.serial = ser
+	a.reader = bufio.NewReader(a.serial)
+	a.partial = nil
+	a.caps = legacyCapabilities
+	return nil
+}
+
+// handshake resets the Arduino, sending up to attempts reset requests, and
+// negotiates the protocol version and capabilities.
+func (a *Arduino93L56R) handshake(ctx context.Context, attempts int) error {
+	request := []byte{protocol.Reset, ProtocolVersion}
+	var lastErr error = timeoutError(protocol.Reset)
+	for i := 1; i <= attempts; i++ {
+		// Reads from a port where nothing answers may block until the reset
+		// timeout, without noticing ctx is done
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		fmt.Printf("Sending reset request. Raw bytes is\n%s", hex.Dump(request))
+		if err := a.send(request); err != nil {
+			return err
+		}
+
+		// Anything other than the acknowledgement is a late response to a
+		// previous connection, or line noise, so the reset is sent again
+		response, err := a.readPacket(ctx, protocol.Reset, resetTimeout)
+		if perr, ok := err.(*ProtocolError); ok {
+			if !perr.Timeout {
+				lastErr = perr
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if a.protocol, err = protocol.ParseResetAck(response); err != nil {
+			return newProtocolError(protocol.Reset, response, err)
+		}
+		fmt.Printf("Response received, using protocol version %d. Raw bytes is\n%s", a.protocol, hex.Dump(append([]byte{protocol.Reset | protocol.AckFlag}, response...)))
+		return a.identify(ctx)
+	}
+
+	return lastErr
+}
+
+// identify asks sketches which support protocol version 4 for their
+// Capabilities. Older sketches are assumed to have the legacyCapabilities.
+func (a *Arduino93L56R) identify(ctx context.Context) error {
+	if a.protocol < 4 {
+		return nil
+	}
+
+	response, err := a.request(ctx, []byte{protocol.Identify})
+	if err != nil {
+		return err
+	}
+	id, err := protocol.ParseIdentity(response)
+	if err != nil {
+		return newProtocolError(protocol.Identify, response, err)
+	}
+	a.caps = newCapabilities(id)
+	fmt.Printf("Programmer firmware version %s, with a %d byte buffer, supports %v EEPROMs at %v baud.\n", a.caps.FirmwareVersion, a.caps.BufferSize, a.caps.IcTypes, a.caps.BaudRates)
+	return nil
+}
+
+// Capabilities returns what the sketch reported during Connect.
+func (a *Arduino93L56R) Capabilities() Capabilities {
+	return a.caps
+}
+
+// ProtocolVersion returns the version of the protocol negotiated by Connect.
+func (a *Arduino93L56R) ProtocolVersion() int {
+	return a.protocol
+}
+
+func (a *Arduino93L56R) Close() {
+	if a.serial == nil {
+		return
+	}
+	a.serial.Close()
+	a.serial = nil
+}
+
+// I2CRead returns length bytes from an I2C EEPROM starting at addr.
+func (a *Arduino93L56R) I2CRead(ctx context.Context, addr int, length int) ([]byte, error) {
+	return a.Read(ctx, addr, length, I2C)
+}
+
+// Read returns length bytes from the EEPROM starting at addr, split into as
+// many read requests as needed for each response to fit the Arduino serial
+// buffer. Each of them is retried on its own if the response is lost or
+// corrupted. It stops between requests once ctx is done.
+func (a *Arduino93L56R) Read(ctx context.Context, addr int, length int, icType IcType) ([]byte, error) {
+	if err := a.checkRequest(addr, length, icType); err != nil {
+		return nil, err
+	}
+
+	wordSize := a.WordSize(icType)
+	// Responses start with the acknowledged command byte
+	headerLen := 1
+	if a.protocol >= 3 {
+		headerLen += sealLen
+	}
+	maxChunkLen := (a.caps.maxPacketLen() - headerLen) / wordSize * wordSize
+
+	buf := make([]byte, 0, length)
+	a.reportProgress(0, length)
+	for offset := 0; offset < length; {
+		chunkAddr := addr + offset/wordSize
+		chunkLen := a.chunkLen(chunkAddr, length-offset, maxChunkLen, icType)
+
+		var chunk []byte
+		var err error
+		for attempt := 0; ; attempt++ {
+			if err = ctx.Err(); err != nil {
+				break
+			}
+			chunk, err = a.readChunk(ctx, chunkAddr, chunkLen, icType)
+			if _, ok := err.(*ProtocolError); !ok || attempt == maxChunkRetries {
+				break
+			}
+			fmt.Printf("Retrying read of %d bytes at address 0x%04X. %s\n", chunkLen, chunkAddr, err)
+			a.discardInput()
+		}
+		if err != nil {
+			if offset == 0 {
+				return nil, err
+			}
+			return nil, &PartialReadError{Addr: chunkAddr, Data: buf, Total: length, Err: err}
+		}
+
+		buf = append(buf, chunk...)
+		offset += chunkLen
+		a.reportProgress(len(buf), length)
+	}
+	return buf, nil
+}
+
+// chunkLen returns the length of the next request, starting at addr with
+// remaining bytes left to transfer, which is at most maxChunkLen. Requests to
+// I2C EEPROMs with block select bits never cross into the next block, since
+// each block has its own device address.
+func (a *Arduino93L56R) chunkLen(addr int, remaining int, maxChunkLen int, icType IcType) int {
+	n := remaining
+	if n > maxChunkLen {
+		n = maxChunkLen
+	}
+	if icType == I2C && a.i2cBlockSelectBits > 0 {
+		if toBoundary := 0x100 - addr&0xFF; n > toBoundary {
+			n = toBoundary
+		}
+	}
+	return n
+}
+
+// checkRequest returns an error if the programmer can not reach the length
+// bytes starting at addr of an EEPROM of icType.
+func (a *Arduino93L56R) checkRequest(addr int, length int, icType IcType) error {
+	if err := a.caps.checkSupports(icType); err != nil {
+		return err
+	}
+	if icType == I2C {
+		return a.checkI2CRange(addr, length)
+	}
+	return a.checkMicrowireRange(addr, length)
+}
+
+// requestHeader returns the start of a read, or write, request, up to and
+// including the length.
+func (a *Arduino93L56R) requestHeader(write bool, addr int, length int, icType IcType) []byte {
+	if icType == I2C {
+		cmd := protocol.I2CRead
+		if write {
+			cmd = protocol.I2CWrite
+		}
+		return a.i2cHeader(cmd, addr, length)
+	}
+
+	cmd := protocol.MicrowireRead
+	if write {
+		cmd = protocol.MicrowireWrite
+	}
+	return a.microwireHeader(cmd, addr, length)
+}
+
+func (a *Arduino93L56R) readChunk(ctx context.Context, addr int, length int, icType IcType) ([]byte, error) {
+	rawBytes := a.requestHeader(false, addr, length, icType)
+
+	// Version 1 sketches respond with the raw bytes read from the EEPROM
+	if a.protocol < 2 {
+		if err := a.send(rawBytes); err != nil {
+			return nil, err
+		}
+		return a.readRaw(ctx, rawBytes[0], length, a.responseTimeout)
+	}
+
+	response, err := a.request(ctx, rawBytes)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := protocol.ParseReadResponse(response, length); err != nil {
+		return nil, newProtocolError(rawBytes[0], response, err)
+	}
+
+	return response, nil
+}
+
+// Write stores buf in the EEPROM starting at addr, split into as many write
+// requests as needed to fit the Arduino serial buffer.
+//
+// Once ctx is done no more requests are sent, and a *PartialWriteError reports
+// how much was written. A request which has already been sent is always
+// waited for, so that the report is exact. Microwire EEPROMs are always left
+// write-disabled.
+func (a *Arduino93L56R) Write(ctx context.Context, addr int, buf []byte, icType IcType) error {
+	if err := a.checkRequest(addr, len(buf), icType); err != nil {
+		return err
+	}
+	if icType == Microwire {
+		return a.withMicrowireWrites(ctx, func() error {
+			return a.write(ctx, addr, buf, icType)
+		})
+	}
+	return a.write(ctx, addr, buf, icType)
+}
+
+// write stores buf in the EEPROM starting at addr, one chunk at a time.
+func (a *Arduino93L56R) write(ctx context.Context, addr int, buf []byte, icType IcType) error {
+	wordSize := a.WordSize(icType)
+	headerLen := len(a.requestHeader(true, addr, 0, icType))
+	if a.protocol >= 3 {
+		headerLen += sealLen
+	}
+	maxChunkLen := (a.caps.maxPacketLen() - headerLen) / wordSize * wordSize
+
+	a.reportProgress(0, len(buf))
+	for offset := 0; ; {
+		chunkAddr := addr + offset/wordSize
+		end := offset + a.chunkLen(chunkAddr, len(buf)-offset, maxChunkLen, icType)
+		if icType == I2C {
+			end = offset + a.i2cPageLen(chunkAddr, end-offset)
+		}
+		if err := ctx.Err(); err != nil {
+			return &PartialWriteError{Addr: chunkAddr, Written: offset, Total: len(buf), Err: err}
+		}
+		if err := a.writeChunk(chunkAddr, buf[offset:end], icType); err != nil {
+			if offset == 0 {
+				return err
+			}
+			return &PartialWriteError{Addr: chunkAddr, Written: offset, Total: len(buf), Err: err}
+		}
+		a.reportProgress(end, len(buf))
+
+		if offset = end; offset >= len(buf) {
+			return nil
+		}
+	}
+}
+
+func (a *Arduino93L56R) writeChunk(addr int, buf []byte, icType IcType) error {
+	// TODO: Length here is *actual* length in bytes. The eeprom has 16bit registers
+	// so length is actually half of length of the supplied buffer. Everything
+	// downstream does the work to translate it. Not sure if this should be register
+	// length, rather than *actual* length.
+	rawBytes := append(a.requestHeader(true, addr, len(buf), icType), buf...)
+
+	// Not cancelled along with the write, see Write
+	response, err := a.request(context.Background(), rawBytes)
+	if err != nil {
+		return err
+	}
+	if err := protocol.ParseWriteAck(response); err != nil {
+		return newProtocolError(rawBytes[0], response, err)
+	}
+	return nil
+}
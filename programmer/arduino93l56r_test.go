@@ -0,0 +1,413 @@
+package programmer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProtocolVersions(t *testing.T) {
+	cases := []struct {
+		name     string
+		options  string
+		expected int
+	}{
+		{"newest sketch", "", ProtocolVersion},
+		{"version 2 sketch", "?protocol=2", 2},
+		{"version 1 sketch", "?protocol=1", 1},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			a := NewArduino93L56R(simulatedPortPrefix + filepath.Join(t.TempDir(), "image.bin") + c.options)
+			if err := a.Connect(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			defer a.Close()
+
+			if a.ProtocolVersion() != c.expected {
+				t.Fatalf("Expected protocol version %d, got %d", c.expected, a.ProtocolVersion())
+			}
+
+			for _, icType := range []IcType{Microwire, I2C} {
+				buf := []byte{0x00, 0x11, 0x22, 0x33, 0x00, 0x00}
+				if err := a.Write(context.Background(), 4, buf, icType); err != nil {
+					t.Fatal(err)
+				}
+				read, err := a.Read(context.Background(), 4, len(buf), icType)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(read, buf) {
+					t.Fatalf("Expected % X read from %s EEPROM, got % X", buf, icType, read)
+				}
+			}
+		})
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	a := NewArduino93L56R(simulatedPortPrefix + filepath.Join(t.TempDir(), "image.bin") + "?buffer=32&bus=i2c")
+	if err := a.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	caps := a.Capabilities()
+	if caps.BufferSize != 32 || !caps.Supports(I2C) || caps.Supports(Microwire) {
+		t.Fatalf("Expected a 32 byte buffer and only i2c support, got %+v", caps)
+	}
+
+	// Both need several packets to fit the small buffer
+	buf := bytes.Repeat([]byte{0x12, 0x34, 0x56}, 40)
+	if err := a.Write(context.Background(), 0, buf, I2C); err != nil {
+		t.Fatal(err)
+	}
+	read, err := a.Read(context.Background(), 0, len(buf), I2C)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, buf) {
+		t.Fatalf("Expected % X, got % X", buf, read)
+	}
+
+	if _, err := a.Read(context.Background(), 0, 2, Microwire); err == nil {
+		t.Fatal("Expected an error reading an unsupported microwire EEPROM, got none")
+	}
+}
+
+// cancelAfter cancels a context once n requests have been written through it.
+type cancelAfter struct {
+	io.ReadWriteCloser
+	n      int
+	cancel context.CancelFunc
+}
+
+func (c *cancelAfter) Write(p []byte) (int, error) {
+	if c.n--; c.n == 0 {
+		c.cancel()
+	}
+	return c.ReadWriteCloser.Write(p)
+}
+
+func TestWriteInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a := NewArduino93L56R(simulatedPortPrefix + filepath.Join(t.TempDir(), "image.bin"))
+	// The reset, identify, write-enable and first write requests
+	a.WrapTransport(func(rwc io.ReadWriteCloser) io.ReadWriteCloser {
+		return &cancelAfter{ReadWriteCloser: rwc, n: 4, cancel: cancel}
+	})
+	if err := a.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	buf := bytes.Repeat([]byte{0xA5}, 200)
+	err := a.Write(ctx, 0x10, buf, Microwire)
+	perr, ok := err.(*PartialWriteError)
+	if !ok {
+		t.Fatalf("Expected a *PartialWriteError, got %v", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the write to have been cancelled, got %v", perr.Err)
+	}
+	if perr.Written == 0 || perr.Written >= len(buf) || perr.Addr != 0x10+perr.Written/2 {
+		t.Fatalf("Expected the first request to have been written, got %+v", perr)
+	}
+	if a.sim.microwireWriteEnabled {
+		t.Fatal("Expected the EEPROM to have been write-disabled after the interrupted write")
+	}
+
+	read, err := a.Read(context.Background(), 0x10, len(buf), Microwire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read[:perr.Written], buf[:perr.Written]) || read[perr.Written] == 0xA5 {
+		t.Fatalf("Expected exactly %d bytes to have been written, got % X", perr.Written, read)
+	}
+}
+
+// dropAckAfter is a cancelAfter which also loses the response to the request
+// it cancels on.
+type dropAckAfter struct {
+	cancelAfter
+	dropping bool
+}
+
+func (d *dropAckAfter) Write(p []byte) (int, error) {
+	d.dropping = d.n == 1
+	return d.cancelAfter.Write(p)
+}
+
+func (d *dropAckAfter) Read(p []byte) (int, error) {
+	n, err := d.cancelAfter.Read(p)
+	if d.dropping {
+		return 0, io.EOF
+	}
+	return n, err
+}
+
+func TestWriteInterruptedWhileEnabling(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a := NewArduino93L56R(simulatedPortPrefix + filepath.Join(t.TempDir(), "image.bin"))
+	// Cancelled as the write-enable request is sent, and its acknowledgement
+	// lost, so the sketch runs EWEN but the request fails
+	a.WrapTransport(func(rwc io.ReadWriteCloser) io.ReadWriteCloser {
+		return &dropAckAfter{cancelAfter: cancelAfter{ReadWriteCloser: rwc, n: 3, cancel: cancel}}
+	})
+	if err := a.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	err := a.Write(ctx, 0x10, bytes.Repeat([]byte{0xA5}, 200), Microwire)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the write to have been cancelled, got %v", err)
+	}
+	if a.sim.microwireWriteEnabled {
+		t.Fatal("Expected the EEPROM to have been write-disabled after the interrupted write")
+	}
+}
+
+func TestWriteDisableFails(t *testing.T) {
+	a := NewArduino93L56R(simulatedPortPrefix + filepath.Join(t.TempDir(), "image.bin"))
+	// The reset, identify, write-enable and first write requests get through
+	a.WrapTransport(func(rwc io.ReadWriteCloser) io.ReadWriteCloser {
+		return &failWrites{ReadWriteCloser: rwc, after: 4}
+	})
+	if err := a.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	err := a.Write(context.Background(), 0x10, bytes.Repeat([]byte{0xA5}, 200), Microwire)
+	var derr *WriteDisableError
+	if !errors.As(err, &derr) {
+		t.Fatalf("Expected a *WriteDisableError, got %v", err)
+	}
+	var perr *PartialWriteError
+	if !errors.As(err, &perr) || perr.Written == 0 {
+		t.Fatalf("Expected the partial write to be reported too, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "may still be write-enabled") {
+		t.Fatalf("Expected the error to warn the EEPROM may be write-enabled, got %v", err)
+	}
+}
+
+func TestReadDeadline(t *testing.T) {
+	// Drop every response after the reset acknowledgement, on a sketch which
+	// does not retransmit
+	a := newFaultyArduino(t, "?protocol=2", Fault{Kind: Drop, Direction: FromDevice, Offset: 4, Count: 1 << 20})
+	if err := a.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := a.Read(ctx, 0, 16, Microwire); err != context.DeadlineExceeded {
+		t.Fatalf("Expected the deadline to be exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > DefaultResponseTimeout/2 {
+		t.Fatalf("Expected the read to stop at the deadline, it took %s", elapsed)
+	}
+}
+
+func TestBaudNegotiation(t *testing.T) {
+	cases := []struct {
+		name     string
+		options  string
+		baud     int
+		expected int
+	}{
+		{"switch", "", 115200, 115200},
+		{"fall back", "?cable=57600", 115200, DefaultBaudRate},
+		{"unsupported rate", "", 250000, DefaultBaudRate},
+		{"legacy sketch", "?protocol=3", 115200, DefaultBaudRate},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			a := NewArduino93L56R(simulatedPortPrefix + filepath.Join(t.TempDir(), "image.bin") + c.options)
+			a.SetBaudRate(c.baud)
+			if err := a.Connect(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			defer a.Close()
+
+			if a.BaudRate() != c.expected {
+				t.Fatalf("Expected to be running at %d baud, got %d", c.expected, a.BaudRate())
+			}
+			buf := []byte{0x01, 0x02, 0x03, 0x04}
+			if err := a.Write(context.Background(), 0, buf, Microwire); err != nil {
+				t.Fatal(err)
+			}
+			read, err := a.Read(context.Background(), 0, len(buf), Microwire)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(read, buf) {
+				t.Fatalf("Expected % X, got % X", buf, read)
+			}
+		})
+	}
+}
+
+func TestReadInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	image := filepath.Join(t.TempDir(), "image.bin")
+	expected := bytes.Repeat([]byte{0x5A, 0xC3}, 100)
+	if err := ioutil.WriteFile(image, expected, 0644); err != nil {
+		t.Fatal(err)
+	}
+	a := NewArduino93L56R(simulatedPortPrefix + image)
+	// The reset, identify, and first read requests
+	a.WrapTransport(func(rwc io.ReadWriteCloser) io.ReadWriteCloser {
+		return &cancelAfter{ReadWriteCloser: rwc, n: 3, cancel: cancel}
+	})
+	var progress []int
+	a.SetProgress(func(done, total int) {
+		progress = append(progress, done)
+	})
+	if err := a.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	_, err := a.Read(ctx, 0, len(expected), Microwire)
+	perr, ok := err.(*PartialReadError)
+	if !ok {
+		t.Fatalf("Expected a *PartialReadError, got %v", err)
+	}
+	if len(perr.Data) == 0 || len(perr.Data) >= len(expected) || perr.Addr != len(perr.Data)/2 {
+		t.Fatalf("Expected the first chunk to have been read, got %+v", perr)
+	}
+	if !bytes.Equal(perr.Data, expected[:len(perr.Data)]) {
+		t.Fatalf("Expected % X, got % X", expected[:len(perr.Data)], perr.Data)
+	}
+	if !reflect.DeepEqual(progress, []int{0, len(perr.Data)}) {
+		t.Fatalf("Expected progress to be reported at the start, and after the first chunk, got %v", progress)
+	}
+}
+
+func TestI2CAddressBytes(t *testing.T) {
+	cases := []struct {
+		name      string
+		options   string
+		addrBytes int
+		addr      int
+		expectErr bool
+	}{
+		{"one byte", "", 1, 0xF0, false},
+		{"one byte out of range", "", 1, 0x100, true},
+		{"two bytes", "", 2, 0x1F00, false},
+		{"two bytes on an old sketch", "?protocol=4", 2, 0x10, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			a := NewArduino93L56R(simulatedPortPrefix + filepath.Join(t.TempDir(), "image.bin") + c.options)
+			a.SetI2CAddressBytes(c.addrBytes)
+			if err := a.Connect(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			defer a.Close()
+
+			buf := []byte{0x24, 0xC3, 0x20, 0x00}
+			err := a.Write(context.Background(), c.addr, buf, I2C)
+			if c.expectErr {
+				if err == nil {
+					t.Fatal("Expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			read, err := a.Read(context.Background(), c.addr, len(buf), I2C)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(read, buf) {
+				t.Fatalf("Expected % X, got % X", buf, read)
+			}
+			// Nothing may have wrapped around to the start of the EEPROM
+			if start, err := a.Read(context.Background(), 0, len(buf), I2C); err != nil || bytes.Equal(start, buf) {
+				t.Fatalf("Expected the start of the EEPROM to be untouched, got % X. Error: %v", start, err)
+			}
+		})
+	}
+}
+
+// failWrites fails every write after the first after writes, like a serial
+// port which was unplugged.
+type failWrites struct {
+	io.ReadWriteCloser
+	after int
+}
+
+func (f *failWrites) Write(p []byte) (int, error) {
+	if f.after > 0 {
+		f.after--
+		return f.ReadWriteCloser.Write(p)
+	}
+	return 0, errors.New("device not configured")
+}
+
+func TestConnectSendFails(t *testing.T) {
+	a := NewArduino93L56R(simulatedPortPrefix + filepath.Join(t.TempDir(), "image.bin"))
+	a.WrapTransport(func(rwc io.ReadWriteCloser) io.ReadWriteCloser {
+		return &failWrites{ReadWriteCloser: rwc}
+	})
+	start := time.Now()
+	err := a.Connect(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "device not configured") {
+		t.Fatalf("Expected the write error, got %v", err)
+	}
+	if time.Since(start) >= resetTimeout {
+		t.Fatalf("Expected Connect to give up at once, it took %s", time.Since(start))
+	}
+}
+
+// recordClose records whether the transport was closed.
+type recordClose struct {
+	io.ReadWriteCloser
+	closed bool
+}
+
+func (r *recordClose) Close() error {
+	r.closed = true
+	return r.ReadWriteCloser.Close()
+}
+
+func TestConnectFailureClosesPort(t *testing.T) {
+	a := NewArduino93L56R(simulatedPortPrefix + filepath.Join(t.TempDir(), "image.bin"))
+	transport := &recordClose{}
+	a.WrapTransport(func(rwc io.ReadWriteCloser) io.ReadWriteCloser {
+		transport.ReadWriteCloser = &failWrites{ReadWriteCloser: rwc}
+		return transport
+	})
+	if err := a.Connect(context.Background()); err == nil {
+		t.Fatal("Expected an error connecting, got none")
+	}
+	if !transport.closed {
+		t.Fatal("Expected the port to have been closed after the failed handshake")
+	}
+	// Closing again, as deferred by callers, is harmless
+	a.Close()
+}
@@ -0,0 +1,65 @@
+package programmer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rgeyer/93l56r-cli/programmer/protocol"
+)
+
+// DefaultBaudRate is the rate every sketch starts at.
+const DefaultBaudRate = 9600
+
+// switchAttempts is how many reset requests are sent after switching baud
+// rate, before falling back to the DefaultBaudRate.
+const switchAttempts = 10
+
+// SetBaudRate sets the rate Connect switches the Arduino to once connected.
+func (a *Arduino93L56R) SetBaudRate(baud int) {
+	a.baud = baud
+}
+
+// BaudRate returns the rate the connection is running at.
+func (a *Arduino93L56R) BaudRate() int {
+	return int(a.serialOpts.BaudRate)
+}
+
+// switchBaud asks the sketch to switch to baud, reopens the serial port at
+// that rate, and repeats the handshake. If the sketch does not respond at the
+// new rate, I.E. because the cable can not carry it, the port is reopened at
+// the DefaultBaudRate instead. The sketch returns to the DefaultBaudRate by
+// itself when it receives nothing it can understand at the new rate. Sketches
+// which do not support baud, I.E. those before protocol version 4, stay at the
+// DefaultBaudRate.
+func (a *Arduino93L56R) switchBaud(ctx context.Context, baud int) error {
+	if !a.caps.SupportsBaudRate(baud) {
+		fmt.Printf("The programmer firmware does not support %d baud, staying at %d baud. It supports: %v\n", baud, DefaultBaudRate, a.caps.BaudRates)
+		return nil
+	}
+
+	response, err := a.request(ctx, protocol.SetBaudRequest(baud))
+	if err != nil {
+		return err
+	}
+	if err := protocol.ParseSetBaudAck(response, baud); err != nil {
+		return newProtocolError(protocol.SetBaud, response, err)
+	}
+
+	if err := a.open(baud); err != nil {
+		return err
+	}
+	err = a.handshake(ctx, switchAttempts)
+	if err == nil {
+		fmt.Printf("Switched to %d baud.\n", baud)
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	fmt.Printf("The programmer did not respond at %d baud, falling back to %d baud. %s\n", baud, DefaultBaudRate, err)
+	if err := a.open(DefaultBaudRate); err != nil {
+		return err
+	}
+	return a.handshake(ctx, resetAttempts)
+}
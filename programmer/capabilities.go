@@ -0,0 +1,92 @@
+package programmer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rgeyer/93l56r-cli/programmer/protocol"
+)
+
+// defaultBufferSize is the serial buffer size of sketches which predate the
+// Identify request.
+const defaultBufferSize = 64
+
+// Capabilities describes what the programmer firmware can do, as learned by
+// Connect.
+type Capabilities struct {
+	// FirmwareVersion is empty for sketches which predate the Identify
+	// request.
+	FirmwareVersion string
+	// BufferSize is the size of the programmer serial buffer. No packet may be
+	// longer than this once encoded, or it would overflow.
+	BufferSize int
+	IcTypes    []IcType
+	BaudRates  []int
+}
+
+// legacyCapabilities are assumed for sketches which predate the Identify
+// request.
+var legacyCapabilities = Capabilities{
+	BufferSize: defaultBufferSize,
+	IcTypes:    []IcType{Microwire, I2C},
+	BaudRates:  []int{DefaultBaudRate},
+}
+
+func newCapabilities(id *protocol.Identity) Capabilities {
+	caps := Capabilities{
+		FirmwareVersion: fmt.Sprintf("%d.%d", id.FirmwareMajor, id.FirmwareMinor),
+		BufferSize:      id.BufferSize,
+		BaudRates:       id.BaudRates,
+	}
+	if id.Buses&protocol.BusMicrowire != 0 {
+		caps.IcTypes = append(caps.IcTypes, Microwire)
+	}
+	if id.Buses&protocol.BusI2C != 0 {
+		caps.IcTypes = append(caps.IcTypes, I2C)
+	}
+	return caps
+}
+
+// Supports returns true if the programmer can talk to EEPROMs of icType.
+func (c Capabilities) Supports(icType IcType) bool {
+	for _, t := range c.IcTypes {
+		if t == icType {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsBaudRate returns true if the programmer can switch to baud.
+func (c Capabilities) SupportsBaudRate(baud int) bool {
+	for _, b := range c.BaudRates {
+		if b == baud {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSupports returns an error if the programmer can not talk to EEPROMs of
+// icType.
+func (c Capabilities) checkSupports(icType IcType) error {
+	if c.Supports(icType) {
+		return nil
+	}
+	supported := make([]string, len(c.IcTypes))
+	for i, t := range c.IcTypes {
+		supported[i] = string(t)
+	}
+	return fmt.Errorf("The programmer firmware does not support %s EEPROMs. It supports: %s", icType, strings.Join(supported, ", "))
+}
+
+// maxPacketLen returns the length of the longest packet which fits in the
+// programmer serial buffer once COBS encoded. COBS adds a code byte for every
+// 254 bytes, plus one, and the delimiter.
+func (c Capabilities) maxPacketLen() int {
+	n := c.BufferSize - 2
+	for n+n/254+2 > c.BufferSize {
+		n--
+	}
+	return n
+}
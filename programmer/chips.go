@@ -0,0 +1,121 @@
+package programmer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Chip describes a serial EEPROM part.
+type Chip struct {
+	Name   string
+	IcType IcType
+	// Size is the capacity in bytes.
+	Size int
+	// WordSize is the number of bytes at each address, I.E. 2 for Microwire
+	// parts organized as 16bit words.
+	WordSize int
+	// AddressBits is the number of address bits the part expects.
+	AddressBits int
+	// PageSize is the most bytes written at once. I2C writes which cross a
+	// page boundary wrap around to the start of the page.
+	PageSize int
+
+	// I2CAddressBytes and I2CBlockSelectBits are only set for I2C parts, see
+	// Arduino93L56R.SetI2CAddressBytes and SetI2CBlockSelectBits.
+	I2CAddressBytes    int
+	I2CBlockSelectBits int
+}
+
+// Chips is the catalog of known parts, by upper case name.
+var Chips = map[string]Chip{}
+
+func init() {
+	for _, c := range []Chip{
+		// Microwire parts, organized as 16bit words, see Organized. Writes are
+		// a word at a time.
+		{Name: "93C46", IcType: Microwire, Size: 128, WordSize: 2, AddressBits: 6, PageSize: 2},
+		{Name: "93C56", IcType: Microwire, Size: 256, WordSize: 2, AddressBits: 8, PageSize: 2},
+		{Name: "93C66", IcType: Microwire, Size: 512, WordSize: 2, AddressBits: 8, PageSize: 2},
+		{Name: "93C76", IcType: Microwire, Size: 1024, WordSize: 2, AddressBits: 10, PageSize: 2},
+		{Name: "93C86", IcType: Microwire, Size: 2048, WordSize: 2, AddressBits: 10, PageSize: 2},
+		// Used by the combination meter, and the ECM
+		{Name: "93L56R", IcType: Microwire, Size: 256, WordSize: 2, AddressBits: 8, PageSize: 2},
+
+		// I2C parts. Those up to 2Kbit have a single address byte, up to
+		// 16Kbit they select a 256 byte block with the low device address
+		// bits, and larger parts have 2 address bytes.
+		{Name: "24C01", IcType: I2C, Size: 128, WordSize: 1, AddressBits: 7, PageSize: 8, I2CAddressBytes: 1},
+		// Used by the BIU
+		{Name: "IS24C01", IcType: I2C, Size: 128, WordSize: 1, AddressBits: 7, PageSize: 8, I2CAddressBytes: 1},
+		{Name: "24C02", IcType: I2C, Size: 256, WordSize: 1, AddressBits: 8, PageSize: 8, I2CAddressBytes: 1},
+		{Name: "24C04", IcType: I2C, Size: 512, WordSize: 1, AddressBits: 9, PageSize: 16, I2CAddressBytes: 1, I2CBlockSelectBits: 1},
+		{Name: "24C08", IcType: I2C, Size: 1024, WordSize: 1, AddressBits: 10, PageSize: 16, I2CAddressBytes: 1, I2CBlockSelectBits: 2},
+		{Name: "24C16", IcType: I2C, Size: 2048, WordSize: 1, AddressBits: 11, PageSize: 16, I2CAddressBytes: 1, I2CBlockSelectBits: 3},
+		{Name: "24C32", IcType: I2C, Size: 4096, WordSize: 1, AddressBits: 12, PageSize: 32, I2CAddressBytes: 2},
+		{Name: "24C64", IcType: I2C, Size: 8192, WordSize: 1, AddressBits: 13, PageSize: 32, I2CAddressBytes: 2},
+		{Name: "24C128", IcType: I2C, Size: 16384, WordSize: 1, AddressBits: 14, PageSize: 64, I2CAddressBytes: 2},
+		{Name: "24C256", IcType: I2C, Size: 32768, WordSize: 1, AddressBits: 15, PageSize: 64, I2CAddressBytes: 2},
+		{Name: "24C512", IcType: I2C, Size: 65536, WordSize: 1, AddressBits: 16, PageSize: 128, I2CAddressBytes: 2},
+	} {
+		Chips[c.Name] = c
+	}
+}
+
+// ChipNames returns the names of every part in the catalog, in order.
+func ChipNames() []string {
+	names := make([]string, 0, len(Chips))
+	for name := range Chips {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupChip returns the part called name, ignoring case.
+func LookupChip(name string) (Chip, error) {
+	chip, ok := Chips[strings.ToUpper(name)]
+	if !ok {
+		return Chip{}, fmt.Errorf("Unknown chip %s. It must be one of: %s", name, strings.Join(ChipNames(), ", "))
+	}
+	return chip, nil
+}
+
+// Organized returns the Microwire part c organized as wordBits, 8 or 16, bits
+// per address by its ORG pin. Organized as x8 it has twice the addresses, so
+// one more address bit.
+func (c Chip) Organized(wordBits int) (Chip, error) {
+	if c.IcType != Microwire {
+		return c, nil
+	}
+	switch wordBits {
+	case 16:
+		return c, nil
+	case 8:
+		c.WordSize = 1
+		c.AddressBits++
+		c.PageSize = 1
+		return c, nil
+	}
+	return Chip{}, fmt.Errorf("Microwire EEPROMs are organized as 8 or 16 bits per address, not %d", wordBits)
+}
+
+// Words returns the number of addresses of the part.
+func (c Chip) Words() int {
+	return c.Size / c.WordSize
+}
+
+// CheckRange returns an error if the length bytes starting at the address
+// addr are not all within the part.
+func (c Chip) CheckRange(addr int, length int) error {
+	if addr < 0 || addr >= c.Words() {
+		return fmt.Errorf("The start address 0x%X is out of range for the %s, which has addresses 0x0 to 0x%X", addr, c.Name, c.Words()-1)
+	}
+	if length%c.WordSize != 0 {
+		return fmt.Errorf("The length must be a multiple of %d bytes for the %s", c.WordSize, c.Name)
+	}
+	if end := addr*c.WordSize + length; end > c.Size {
+		return fmt.Errorf("Reading or writing %d bytes from address 0x%X runs %d bytes past the end of the %s, which is %d bytes", length, addr, end-c.Size, c.Name, c.Size)
+	}
+	return nil
+}
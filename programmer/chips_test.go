@@ -0,0 +1,72 @@
+package programmer
+
+import "testing"
+
+func TestChips(t *testing.T) {
+	for _, name := range ChipNames() {
+		c := Chips[name]
+		if c.WordSize != c.IcType.WordSize() {
+			t.Errorf("%s: expected word size %d, got %d", name, c.IcType.WordSize(), c.WordSize)
+		}
+		if c.Size%c.PageSize != 0 || c.PageSize%c.WordSize != 0 {
+			t.Errorf("%s: page size %d does not divide the size %d into words", name, c.PageSize, c.Size)
+		}
+		if c.IcType == I2C {
+			if limit := 1 << (8*uint(c.I2CAddressBytes) + uint(c.I2CBlockSelectBits)); c.Size > limit {
+				t.Errorf("%s: %d bytes can not be reached with %d address bytes and %d block select bits", name, c.Size, c.I2CAddressBytes, c.I2CBlockSelectBits)
+			}
+		} else if c.Words() > 1<<uint(c.AddressBits) {
+			t.Errorf("%s: %d words can not be reached with %d address bits", name, c.Words(), c.AddressBits)
+		}
+	}
+}
+
+func TestLookupChip(t *testing.T) {
+	c, err := LookupChip("24c16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "24C16" || c.I2CBlockSelectBits != 3 {
+		t.Fatalf("Expected the 24C16, got %+v", c)
+	}
+	if _, err := LookupChip("27C256"); err == nil {
+		t.Fatal("Expected an error looking up an unknown chip, got none")
+	}
+}
+
+func TestChipCheckRange(t *testing.T) {
+	c := Chips["93C56"]
+	cases := []struct {
+		addr      int
+		length    int
+		expectErr bool
+	}{
+		{0, 256, false},
+		{0x7F, 2, false},
+		{0x80, 2, true},
+		{0x7F, 4, true},
+		{0, 3, true},
+		{-1, 2, true},
+	}
+	for _, tc := range cases {
+		err := c.CheckRange(tc.addr, tc.length)
+		if tc.expectErr && err == nil {
+			t.Errorf("Expected an error for %d bytes at 0x%X, got none", tc.length, tc.addr)
+		} else if !tc.expectErr && err != nil {
+			t.Errorf("Expected no error for %d bytes at 0x%X, got %s", tc.length, tc.addr, err)
+		}
+	}
+}
+
+func TestChipOrganized(t *testing.T) {
+	c, err := Chips["93C86"].Organized(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.WordSize != 1 || c.AddressBits != 11 || c.Words() != 2048 {
+		t.Fatalf("Expected 2048 byte addresses with 11 address bits, got %+v", c)
+	}
+	if _, err := Chips["93C46"].Organized(32); err == nil {
+		t.Fatal("Expected an error organizing as x32, got none")
+	}
+}
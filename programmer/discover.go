@@ -0,0 +1,134 @@
+package programmer
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rgeyer/93l56r-cli/programmer/protocol"
+)
+
+// AutoPort is the serial port name which makes Connect find the programmer
+// with FindProgrammer.
+const AutoPort = "auto"
+
+// candidatePatterns match the serial ports an Arduino may appear as. The
+// stable /dev/serial/by-id names come first, so they are preferred over the
+// ttyACM and ttyUSB devices they link to.
+var candidatePatterns = []string{
+	"/dev/serial/by-id/*",
+	"/dev/ttyACM*",
+	"/dev/ttyUSB*",
+	"/dev/cu.usbmodem*",
+	"/dev/cu.usbserial*",
+}
+
+// probeTimeout is how long Probe waits for a port to answer the reset
+// handshake. Arduinos reset when the port is opened, and the bootloader runs
+// for a couple of seconds before the sketch starts.
+const probeTimeout = 4 * time.Second
+
+// ProbeResult is what was found on a serial port by Probe.
+type ProbeResult struct {
+	Port string
+	// ProtocolVersion and Capabilities are only set when Err is nil.
+	ProtocolVersion int
+	Capabilities    Capabilities
+	// Err is why the port is not a programmer, I.E. it did not respond.
+	Err error
+}
+
+// CandidatePorts returns the serial ports which may have a programmer
+// connected. Ports reachable through more than one name are only returned
+// once.
+func CandidatePorts() ([]string, error) {
+	var ports []string
+	seen := map[string]bool{}
+	for _, pattern := range candidatePatterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		for _, port := range matches {
+			device, err := filepath.EvalSymlinks(port)
+			if err != nil {
+				device = port
+			}
+			if seen[device] {
+				continue
+			}
+			seen[device] = true
+			ports = append(ports, port)
+		}
+	}
+	return ports, nil
+}
+
+// Probe connects to the programmer on port using the reset handshake, and
+// reports what it found.
+func Probe(ctx context.Context, port string, responseTimeout time.Duration) ProbeResult {
+	result := ProbeResult{Port: port}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	a := NewArduino93L56R(port)
+	a.SetResponseTimeout(responseTimeout)
+	if result.Err = a.Connect(ctx); result.Err != nil {
+		if result.Err == context.DeadlineExceeded {
+			result.Err = timeoutError(protocol.Reset)
+		}
+		return result
+	}
+	defer a.Close()
+
+	result.ProtocolVersion = a.ProtocolVersion()
+	result.Capabilities = a.Capabilities()
+	return result
+}
+
+// ProbePorts probes every one of the CandidatePorts.
+func ProbePorts(ctx context.Context, responseTimeout time.Duration) ([]ProbeResult, error) {
+	ports, err := CandidatePorts()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []ProbeResult
+	for _, port := range ports {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		results = append(results, Probe(ctx, port, responseTimeout))
+	}
+	return results, nil
+}
+
+// FindProgrammer returns the only one of the CandidatePorts with a programmer
+// connected. It is an error if there are none, or several.
+func FindProgrammer(ctx context.Context, responseTimeout time.Duration) (string, error) {
+	results, err := ProbePorts(ctx, responseTimeout)
+	if err != nil {
+		return "", err
+	}
+
+	var found []string
+	for _, result := range results {
+		if result.Err == nil {
+			found = append(found, result.Port)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("Unable to find a programmer. None of the %d candidate serial ports responded. Run the ports command for details.", len(results))
+	case 1:
+		fmt.Printf("Found a programmer on %s\n", found[0])
+		return found[0], nil
+	}
+	return "", fmt.Errorf("Found a programmer on each of %s. Choose one with --serial-port.", strings.Join(found, ", "))
+}
@@ -0,0 +1,104 @@
+package programmer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// withCandidatePatterns replaces the candidatePatterns for the rest of the
+// test.
+func withCandidatePatterns(t *testing.T, patterns ...string) {
+	saved := candidatePatterns
+	candidatePatterns = patterns
+	t.Cleanup(func() { candidatePatterns = saved })
+}
+
+func TestCandidatePorts(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"ttyACM1", "ttyACM0", "ttyUSB0"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	byID := filepath.Join(dir, "by-id")
+	if err := os.Mkdir(byID, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "ttyACM1"), filepath.Join(byID, "usb-Arduino")); err != nil {
+		t.Fatal(err)
+	}
+
+	withCandidatePatterns(t, filepath.Join(byID, "*"), filepath.Join(dir, "ttyACM*"), filepath.Join(dir, "ttyUSB*"))
+	ports, err := CandidatePorts()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{filepath.Join(byID, "usb-Arduino"), filepath.Join(dir, "ttyACM0"), filepath.Join(dir, "ttyUSB0")}
+	if !reflect.DeepEqual(ports, expected) {
+		t.Fatalf("Expected %v, got %v", expected, ports)
+	}
+}
+
+func TestFindProgrammer(t *testing.T) {
+	emulator, err := NewEmulator(filepath.Join(t.TempDir(), "image.bin"))
+	if err != nil {
+		t.Skipf("Unable to emulate an Arduino. Error: %s", err)
+	}
+	defer emulator.Close()
+	go emulator.Serve()
+
+	// Nothing answers on the regular file
+	silent := filepath.Join(t.TempDir(), "ttyUSB0")
+	if err := ioutil.WriteFile(silent, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	withCandidatePatterns(t, emulator.SlavePath, silent)
+	port, err := FindProgrammer(context.Background(), DefaultResponseTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port != emulator.SlavePath {
+		t.Fatalf("Expected the programmer on %s, got %s", emulator.SlavePath, port)
+	}
+}
+
+// openFiles returns how many times path is open in this process.
+func openFiles(t *testing.T, path string) int {
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skipf("Unable to list the open files. Error: %s", err)
+	}
+	count := 0
+	for _, fd := range fds {
+		if target, err := os.Readlink(filepath.Join("/proc/self/fd", fd.Name())); err == nil && target == path {
+			count++
+		}
+	}
+	return count
+}
+
+func TestProbeClosesSilentPort(t *testing.T) {
+	// The emulator does not answer until it is served
+	emulator, err := NewEmulator(filepath.Join(t.TempDir(), "image.bin"))
+	if err != nil {
+		t.Skipf("Unable to emulate an Arduino. Error: %s", err)
+	}
+	defer emulator.Close()
+	before := openFiles(t, emulator.SlavePath)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if result := Probe(ctx, emulator.SlavePath, DefaultResponseTimeout); result.Err == nil {
+		t.Fatal("Expected an error probing a port without a programmer, got none")
+	}
+	if open := openFiles(t, emulator.SlavePath); open != before {
+		t.Fatalf("Expected the port to have been closed after the failed probe, it is open %d more times", open-before)
+	}
+}
@@ -0,0 +1,81 @@
+package programmer
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Emulator serves a simulated Arduino on a pseudo terminal. It behaves like
+// the subaru immo sketch byte for byte, so the CLI can be pointed at
+// SlavePath with --serial-port and tested end to end through a real serial
+// port.
+type Emulator struct {
+	// SlavePath is the device path of the pseudo terminal to connect to.
+	SlavePath string
+
+	sim    *simulatedSerial
+	device io.ReadWriteCloser
+	master *os.File
+	slave  *os.File
+}
+
+// NewEmulator opens a pseudo terminal for an emulated Arduino, which keeps
+// the EEPROM contents in the file at imagePath.
+func NewEmulator(imagePath string) (*Emulator, error) {
+	sim, err := newSimulatedSerial(imagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	master, slave, err := openPty()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Emulator{
+		SlavePath: slave.Name(),
+		sim:       sim,
+		device:    sim,
+		master:    master,
+		slave:     slave,
+	}, nil
+}
+
+// InjectFaults makes the emulator inject faults into the requests it receives,
+// and the responses it sends, using a FaultyTransport. It must be called
+// before Serve.
+func (e *Emulator) InjectFaults(faults ...Fault) {
+	e.device = NewFaultyTransport(e.sim, faults...)
+}
+
+// Serve answers requests arriving on the pseudo terminal until it is closed,
+// or an error occurs.
+func (e *Emulator) Serve() error {
+	buf := make([]byte, 256)
+	for {
+		n, err := e.master.Read(buf)
+		if err != nil {
+			return err
+		}
+
+		if _, err := e.device.Write(buf[:n]); err != nil {
+			return err
+		}
+
+		// The simulator reports io.EOF once every response has been read
+		responses, _ := ioutil.ReadAll(e.device)
+		if len(responses) == 0 {
+			continue
+		}
+		if _, err := e.master.Write(responses); err != nil {
+			return err
+		}
+	}
+}
+
+// Close closes the pseudo terminal.
+func (e *Emulator) Close() error {
+	e.slave.Close()
+	return e.master.Close()
+}
@@ -0,0 +1,49 @@
+package programmer
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestEmulator(t *testing.T) {
+	image := filepath.Join(t.TempDir(), "image.bin")
+	emulator, err := NewEmulator(image)
+	if err != nil {
+		t.Skipf("Unable to emulate an Arduino. Error: %s", err)
+	}
+	defer emulator.Close()
+	go emulator.Serve()
+
+	// Connects through serial.Open, like to a real Arduino
+	a := NewArduino93L56R(emulator.SlavePath)
+	if err := a.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	if a.sim != nil {
+		t.Fatal("Expected a serial port, not the in process simulator")
+	}
+
+	buf := bytes.Repeat([]byte{0x93, 0x56}, 100)
+	if err := a.Write(context.Background(), 0x10, buf, Microwire); err != nil {
+		t.Fatal(err)
+	}
+	read, err := a.Read(context.Background(), 0x10, len(buf), Microwire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, buf) {
+		t.Fatalf("Expected % X, got % X", buf, read)
+	}
+
+	saved, err := ioutil.ReadFile(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(saved[0x20:], buf) {
+		t.Fatalf("Expected the image to hold the buffer at 0x20, got\n% X", saved)
+	}
+}
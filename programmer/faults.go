@@ -0,0 +1,218 @@
+package programmer
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FaultKind is the kind of fault a FaultyTransport injects.
+type FaultKind string
+
+const (
+	// Drop removes Count bytes from the stream.
+	Drop FaultKind = "drop"
+	// Corrupt flips every bit of Count bytes.
+	Corrupt FaultKind = "corrupt"
+	// Delay holds the bytes back for Delay before passing them on.
+	Delay FaultKind = "delay"
+	// Truncate drops the rest of the Read or Write call the fault happens in.
+	Truncate FaultKind = "truncate"
+	// Reset simulates the device resetting. The rest of the Read or Write call
+	// is dropped, along with any response the device had not sent yet.
+	Reset FaultKind = "reset"
+)
+
+// Direction is the direction bytes travel through a FaultyTransport.
+type Direction string
+
+const (
+	// ToDevice is the direction of the requests written to the device.
+	ToDevice Direction = "out"
+	// FromDevice is the direction of the responses read from the device.
+	FromDevice Direction = "in"
+)
+
+// Fault is a single fault injected by a FaultyTransport. It happens once, when
+// the stream of bytes travelling in Direction reaches Offset.
+type Fault struct {
+	Kind      FaultKind
+	Direction Direction
+	// Offset counts the bytes which travelled in Direction since the
+	// FaultyTransport was created, starting at 0.
+	Offset int
+	// Count is the number of bytes affected by Drop and Corrupt. Default is 1.
+	Count int
+	// Delay is how long a Delay fault holds the bytes back.
+	Delay time.Duration
+
+	fired bool
+}
+
+// ParseFault parses a fault from a kind:direction:offset[:count|delay] spec,
+// I.E. drop:in:5:2, corrupt:out:3, delay:in:0:500ms, truncate:in:10 or
+// reset:out:40
+func ParseFault(spec string) (Fault, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) < 3 || len(parts) > 4 {
+		return Fault{}, fmt.Errorf("Unable to parse fault %q. Expected kind:direction:offset[:count|delay]", spec)
+	}
+
+	fault := Fault{Kind: FaultKind(parts[0]), Direction: Direction(parts[1]), Count: 1}
+	switch fault.Kind {
+	case Drop, Corrupt, Delay, Truncate, Reset:
+	default:
+		return Fault{}, fmt.Errorf("Unable to parse fault %q. The kind must be one of: drop, corrupt, delay, truncate, reset", spec)
+	}
+	if fault.Direction != ToDevice && fault.Direction != FromDevice {
+		return Fault{}, fmt.Errorf("Unable to parse fault %q. The direction must be one of: in, out", spec)
+	}
+
+	offset, err := strconv.Atoi(parts[2])
+	if err != nil || offset < 0 {
+		return Fault{}, fmt.Errorf("Unable to parse fault %q. The offset must be a positive number", spec)
+	}
+	fault.Offset = offset
+
+	if len(parts) == 4 {
+		if fault.Kind == Delay {
+			if fault.Delay, err = time.ParseDuration(parts[3]); err != nil {
+				return Fault{}, fmt.Errorf("Unable to parse fault %q. Error: %s", spec, err)
+			}
+		} else if fault.Count, err = strconv.Atoi(parts[3]); err != nil || fault.Count < 1 {
+			return Fault{}, fmt.Errorf("Unable to parse fault %q. The count must be a positive number", spec)
+		}
+	}
+
+	return fault, nil
+}
+
+// resetter is implemented by transports which can simulate a device reset,
+// such as the simulator.
+type resetter interface {
+	Reset()
+}
+
+// FaultyTransport wraps the serial connection to a programmer, and injects
+// faults into the bytes passing through it. It is meant for testing how the
+// programmer copes with a bad connection, by wrapping the connection of an
+// Arduino93L56R using WrapTransport, or the simulator of an Emulator.
+type FaultyTransport struct {
+	rwc    io.ReadWriteCloser
+	faults []*Fault
+	offset map[Direction]int
+}
+
+// NewFaultyTransport returns a FaultyTransport which injects faults into the
+// bytes passing through rwc.
+func NewFaultyTransport(rwc io.ReadWriteCloser, faults ...Fault) *FaultyTransport {
+	t := &FaultyTransport{
+		rwc:    rwc,
+		offset: map[Direction]int{},
+	}
+	for i := range faults {
+		fault := faults[i]
+		if fault.Count < 1 {
+			fault.Count = 1
+		}
+		t.faults = append(t.faults, &fault)
+	}
+	return t
+}
+
+// Read reads from the wrapped connection, injecting any FromDevice faults.
+func (t *FaultyTransport) Read(p []byte) (int, error) {
+	for {
+		n, err := t.rwc.Read(p)
+		if n == 0 {
+			return n, err
+		}
+
+		out, reset := t.inject(FromDevice, p[:n])
+		if reset {
+			t.Reset()
+		}
+		copy(p, out)
+		if len(out) > 0 || err != nil {
+			return len(out), err
+		}
+		// Every byte was dropped, wait for some more like a real port would
+	}
+}
+
+// Write writes to the wrapped connection, injecting any ToDevice faults. Like
+// a real serial port, dropped bytes are still reported as written.
+func (t *FaultyTransport) Write(p []byte) (int, error) {
+	out, reset := t.inject(ToDevice, p)
+	if len(out) > 0 {
+		if _, err := t.rwc.Write(out); err != nil {
+			return 0, err
+		}
+	}
+	if reset {
+		t.Reset()
+	}
+	return len(p), nil
+}
+
+// Close closes the wrapped connection.
+func (t *FaultyTransport) Close() error {
+	return t.rwc.Close()
+}
+
+// Reset passes a reset on to the wrapped connection, so a FaultyTransport can
+// itself be wrapped.
+func (t *FaultyTransport) Reset() {
+	if r, ok := t.rwc.(resetter); ok {
+		r.Reset()
+	}
+}
+
+// inject returns buf with every fault for dir which falls within it applied,
+// and whether a Reset fault happened after the returned bytes.
+func (t *FaultyTransport) inject(dir Direction, buf []byte) ([]byte, bool) {
+	start := t.offset[dir]
+	t.offset[dir] += len(buf)
+
+	out := make([]byte, 0, len(buf))
+	for i, b := range buf {
+		pos := start + i
+		keep := true
+		for _, fault := range t.faults {
+			if fault.Direction != dir || pos < fault.Offset {
+				continue
+			}
+			switch fault.Kind {
+			case Drop:
+				if pos < fault.Offset+fault.Count {
+					keep = false
+				}
+			case Corrupt:
+				if pos < fault.Offset+fault.Count {
+					b ^= 0xFF
+				}
+			case Delay:
+				if !fault.fired {
+					fault.fired = true
+					time.Sleep(fault.Delay)
+				}
+			case Truncate:
+				if !fault.fired {
+					fault.fired = true
+					return out, false
+				}
+			case Reset:
+				if !fault.fired {
+					fault.fired = true
+					return out, true
+				}
+			}
+		}
+		if keep {
+			out = append(out, b)
+		}
+	}
+	return out, false
+}
@@ -0,0 +1,207 @@
+package programmer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// recorder is a connection which records everything written to it, and has
+// nothing to read.
+type recorder struct {
+	bytes.Buffer
+	resets int
+}
+
+func (r *recorder) Close() error { return nil }
+func (r *recorder) Reset()       { r.resets++ }
+
+func TestFaultyTransportWrite(t *testing.T) {
+	cases := []struct {
+		name     string
+		faults   []Fault
+		writes   [][]byte
+		expected []byte
+		resets   int
+	}{
+		{"no faults", nil, [][]byte{{1, 2, 3}}, []byte{1, 2, 3}, 0},
+		{"drop", []Fault{{Kind: Drop, Direction: ToDevice, Offset: 1, Count: 2}}, [][]byte{{1, 2, 3, 4}}, []byte{1, 4}, 0},
+		{"drop across writes", []Fault{{Kind: Drop, Direction: ToDevice, Offset: 1, Count: 2}}, [][]byte{{1, 2}, {3, 4}}, []byte{1, 4}, 0},
+		{"corrupt", []Fault{{Kind: Corrupt, Direction: ToDevice, Offset: 2}}, [][]byte{{1, 2, 3}}, []byte{1, 2, 0xFC}, 0},
+		{"truncate", []Fault{{Kind: Truncate, Direction: ToDevice, Offset: 1}}, [][]byte{{1, 2, 3}, {4}}, []byte{1, 4}, 0},
+		{"reset", []Fault{{Kind: Reset, Direction: ToDevice, Offset: 2}}, [][]byte{{1, 2, 3}, {4}}, []byte{1, 2, 4}, 1},
+		{"other direction", []Fault{{Kind: Drop, Direction: FromDevice, Offset: 0}}, [][]byte{{1, 2}}, []byte{1, 2}, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rec := &recorder{}
+			ft := NewFaultyTransport(rec, c.faults...)
+			for _, w := range c.writes {
+				if n, err := ft.Write(w); n != len(w) || err != nil {
+					t.Fatalf("Expected %d bytes written, got %d. Error: %v", len(w), n, err)
+				}
+			}
+			if !bytes.Equal(rec.Bytes(), c.expected) {
+				t.Fatalf("Expected % X written, got % X", c.expected, rec.Bytes())
+			}
+			if rec.resets != c.resets {
+				t.Fatalf("Expected %d resets, got %d", c.resets, rec.resets)
+			}
+		})
+	}
+}
+
+func TestParseFault(t *testing.T) {
+	cases := []struct {
+		spec      string
+		expected  Fault
+		expectErr bool
+	}{
+		{"drop:in:5:2", Fault{Kind: Drop, Direction: FromDevice, Offset: 5, Count: 2}, false},
+		{"corrupt:out:3", Fault{Kind: Corrupt, Direction: ToDevice, Offset: 3, Count: 1}, false},
+		{"delay:in:0:500ms", Fault{Kind: Delay, Direction: FromDevice, Count: 1, Delay: 500 * time.Millisecond}, false},
+		{"reset:out:40", Fault{Kind: Reset, Direction: ToDevice, Offset: 40, Count: 1}, false},
+		{"explode:in:1", Fault{}, true},
+		{"drop:sideways:1", Fault{}, true},
+		{"drop:in:-1", Fault{}, true},
+		{"drop:in:1:0", Fault{}, true},
+		{"drop:in", Fault{}, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.spec, func(t *testing.T) {
+			fault, err := ParseFault(c.spec)
+			if c.expectErr {
+				if err == nil {
+					t.Fatal("Expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fault != c.expected {
+				t.Fatalf("Expected %+v, got %+v", c.expected, fault)
+			}
+		})
+	}
+}
+
+// newFaultyArduino returns an Arduino93L56R connected to a simulator with
+// options through a FaultyTransport injecting faults.
+func newFaultyArduino(t *testing.T, options string, faults ...Fault) *Arduino93L56R {
+	a := NewArduino93L56R(simulatedPortPrefix + filepath.Join(t.TempDir(), "image.bin") + options)
+	a.WrapTransport(func(rwc io.ReadWriteCloser) io.ReadWriteCloser {
+		return NewFaultyTransport(rwc, faults...)
+	})
+	return a
+}
+
+func TestConnectRetriesDroppedReset(t *testing.T) {
+	// The first reset request is 4 bytes long
+	a := newFaultyArduino(t, "", Fault{Kind: Drop, Direction: ToDevice, Offset: 0, Count: 4})
+	if err := a.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	a.Close()
+}
+
+func TestReadRetriesCorruptResponse(t *testing.T) {
+	// The reset acknowledgement is 4 bytes long, the command byte of the read
+	// response follows the COBS code byte after it. The sketch does not seal
+	// its packets, so the read is retried rather than retransmitted.
+	a := newFaultyArduino(t, "?protocol=2", Fault{Kind: Corrupt, Direction: FromDevice, Offset: 4 + 1})
+	if err := a.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	read, err := a.Read(context.Background(), 0, 32, Microwire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, bytes.Repeat([]byte{0xFF}, 32)) {
+		t.Fatalf("Expected an erased EEPROM, got % X", read)
+	}
+}
+
+func TestReadGivesUpAfterRetries(t *testing.T) {
+	// Corrupt the command byte of the first response, and of every retry
+	var faults []Fault
+	offset := 4
+	for i := 0; i <= maxChunkRetries; i++ {
+		faults = append(faults, Fault{Kind: Corrupt, Direction: FromDevice, Offset: offset + 1})
+		// Each response is the command byte, 32 data bytes, a COBS code byte
+		// and the delimiter
+		offset += 35
+	}
+	a := newFaultyArduino(t, "?protocol=2", faults...)
+	if err := a.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	_, err := a.Read(context.Background(), 0, 32, Microwire)
+	if _, ok := err.(*ProtocolError); !ok {
+		t.Fatalf("Expected a *ProtocolError reading a corrupt response, got %v", err)
+	}
+}
+
+func TestWriteSurvivesDelayedAck(t *testing.T) {
+	a := newFaultyArduino(t, "", Fault{Kind: Delay, Direction: FromDevice, Offset: 4, Delay: 300 * time.Millisecond})
+	if err := a.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	buf := []byte{0xDE, 0xAD, 0xBE, 0xEF}
+	if err := a.Write(context.Background(), 0, buf, Microwire); err != nil {
+		t.Fatal(err)
+	}
+	read, err := a.Read(context.Background(), 0, len(buf), Microwire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, buf) {
+		t.Fatalf("Expected % X, got % X", buf, read)
+	}
+}
+
+func TestRetransmitCorruptPackets(t *testing.T) {
+	cases := []struct {
+		name  string
+		fault Fault
+	}{
+		// Both reset packets are 4 bytes long, so these corrupt the first
+		// byte of the data in the write request, and the CRC of its acknowledgement
+		{"corrupt request", Fault{Kind: Corrupt, Direction: ToDevice, Offset: 4 + 7}},
+		{"corrupt response", Fault{Kind: Corrupt, Direction: FromDevice, Offset: 4 + 3}},
+		{"dropped response", Fault{Kind: Drop, Direction: FromDevice, Offset: 4, Count: 6}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			a := newFaultyArduino(t, "?protocol=3", c.fault)
+			if err := a.Connect(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			defer a.Close()
+
+			buf := []byte{0xDE, 0xAD, 0xBE, 0xEF}
+			if err := a.Write(context.Background(), 0, buf, Microwire); err != nil {
+				t.Fatal(err)
+			}
+			read, err := a.Read(context.Background(), 0, len(buf), Microwire)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(read, buf) {
+				t.Fatalf("Expected % X, got % X", buf, read)
+			}
+		})
+	}
+}
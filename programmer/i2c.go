@@ -0,0 +1,121 @@
+package programmer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rgeyer/93l56r-cli/programmer/protocol"
+)
+
+// DefaultI2CAddress is the I2C device address of an EEPROM with its address
+// pins tied low.
+const DefaultI2CAddress = 0x50
+
+// The range of I2C device addresses an EEPROM may use, and which are probed
+// by ScanI2C. The others are reserved by the I2C specification.
+const (
+	FirstI2CAddress = 0x08
+	LastI2CAddress  = 0x77
+)
+
+// SetI2CAddress sets the device address of the I2C EEPROM.
+func (a *Arduino93L56R) SetI2CAddress(addr byte) {
+	a.i2cAddress = addr
+}
+
+// SetI2CAddressBytes sets how many address bytes the I2C EEPROM expects, 1
+// for parts up to 24C16, or 2 for 24C32 and larger parts.
+func (a *Arduino93L56R) SetI2CAddressBytes(n int) {
+	a.i2cAddressBytes = n
+}
+
+// SetI2CBlockSelectBits sets how many of the low device address bits the I2C
+// EEPROM uses to select a 256 byte block. I.E. 1 for the 24C04, 2 for the
+// 24C08 and 3 for the 24C16.
+func (a *Arduino93L56R) SetI2CBlockSelectBits(n int) {
+	a.i2cBlockSelectBits = n
+}
+
+// SetI2CPageSize sets the page size of the I2C EEPROM. Writes are split so
+// none cross a page boundary, since the EEPROM would wrap around to the start
+// of the page. 0, the default, does not split writes.
+func (a *Arduino93L56R) SetI2CPageSize(n int) {
+	a.i2cPageSize = n
+}
+
+// i2cPageLen returns n, or less if writing n bytes at addr would cross an I2C
+// page boundary.
+func (a *Arduino93L56R) i2cPageLen(addr int, n int) int {
+	if a.i2cPageSize <= 0 {
+		return n
+	}
+	if toBoundary := a.i2cPageSize - addr%a.i2cPageSize; n > toBoundary {
+		return toBoundary
+	}
+	return n
+}
+
+// i2cHeader returns the start of an I2C request, see protocol.I2CHeader. The
+// block holding addr is selected with the device address, if the EEPROM has
+// block select bits.
+func (a *Arduino93L56R) i2cHeader(cmd byte, addr int, length int) []byte {
+	devAddr := a.i2cAddress
+	if a.i2cBlockSelectBits > 0 {
+		devAddr |= byte(addr>>8) & (1<<uint(a.i2cBlockSelectBits) - 1)
+	}
+	return protocol.I2CHeader(cmd, a.protocol, devAddr, a.i2cAddressBytes, addr, length)
+}
+
+// checkI2CRange returns an error if the length bytes starting at addr can not
+// be reached with the I2C address bytes and block select bits, or the sketch
+// can not send them.
+func (a *Arduino93L56R) checkI2CRange(addr int, length int) error {
+	if a.i2cAddress < FirstI2CAddress || a.i2cAddress > LastI2CAddress {
+		return fmt.Errorf("The I2C device address must be between 0x%02X and 0x%02X, not 0x%02X", FirstI2CAddress, LastI2CAddress, a.i2cAddress)
+	}
+	if a.i2cAddressBytes != 1 && a.i2cAddressBytes != 2 {
+		return fmt.Errorf("I2C EEPROMs use 1 or 2 address bytes, not %d", a.i2cAddressBytes)
+	}
+	if a.i2cAddressBytes == 2 && a.protocol < 5 {
+		return fmt.Errorf("The programmer firmware only supports I2C EEPROMs with 1 address byte. Protocol version 5 is needed for 2 address bytes, it supports version %d", a.protocol)
+	}
+	if a.i2cBlockSelectBits < 0 || a.i2cBlockSelectBits > 3 || (a.i2cBlockSelectBits > 0 && a.i2cAddressBytes != 1) {
+		return fmt.Errorf("I2C EEPROMs with 1 address byte use up to 3 block select bits, and others none, not %d", a.i2cBlockSelectBits)
+	}
+	if a.i2cAddress&(1<<uint(a.i2cBlockSelectBits)-1) != 0 {
+		return fmt.Errorf("The block select bits of the I2C device address 0x%02X must be 0", a.i2cAddress)
+	}
+
+	limit := 1 << (8*uint(a.i2cAddressBytes) + uint(a.i2cBlockSelectBits))
+	if end := addr + length - 1; addr < 0 || end >= limit {
+		return fmt.Errorf("Address 0x%X is out of range for I2C EEPROMs with %d address bytes and %d block select bits", end, a.i2cAddressBytes, a.i2cBlockSelectBits)
+	}
+	return nil
+}
+
+// ScanI2C probes every I2C device address from 0x08 to 0x77, and returns
+// those which acknowledged.
+func (a *Arduino93L56R) ScanI2C(ctx context.Context) ([]byte, error) {
+	if err := a.caps.checkSupports(I2C); err != nil {
+		return nil, err
+	}
+	if a.protocol < 6 {
+		return nil, fmt.Errorf("The programmer firmware can not scan the I2C bus. Protocol version 6 is needed, it supports version %d", a.protocol)
+	}
+
+	var found []byte
+	for devAddr := FirstI2CAddress; devAddr <= LastI2CAddress; devAddr++ {
+		response, err := a.request(ctx, []byte{protocol.I2CProbe, byte(devAddr)})
+		if err != nil {
+			return nil, err
+		}
+		present, err := protocol.ParseI2CProbeAck(response)
+		if err != nil {
+			return nil, newProtocolError(protocol.I2CProbe, response, err)
+		}
+		if present {
+			found = append(found, byte(devAddr))
+		}
+	}
+	return found, nil
+}
@@ -0,0 +1,106 @@
+package programmer
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestI2CBlockSelect(t *testing.T) {
+	image := filepath.Join(t.TempDir(), "image.bin")
+	a := NewArduino93L56R(simulatedPortPrefix + image)
+	a.SetI2CBlockSelectBits(3)
+	if err := a.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	// Crosses from the second block into the third
+	buf := bytes.Repeat([]byte{0x16}, 40)
+	if err := a.Write(context.Background(), 0x1F0, buf, I2C); err != nil {
+		t.Fatal(err)
+	}
+	read, err := a.Read(context.Background(), 0x1F0, len(buf), I2C)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, buf) {
+		t.Fatalf("Expected % X, got % X", buf, read)
+	}
+
+	saved, err := ioutil.ReadFile(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 0x1F0+len(buf) || !bytes.Equal(saved[0x1F0:], buf) {
+		t.Fatalf("Expected the image to hold the buffer at 0x1F0, got\n% X", saved)
+	}
+
+	if err := a.Write(context.Background(), 0x7FF, []byte{1, 2}, I2C); err == nil {
+		t.Fatal("Expected an error writing past the end of a 24C16, got none")
+	}
+}
+
+func TestScanI2C(t *testing.T) {
+	a := NewArduino93L56R(simulatedPortPrefix + filepath.Join(t.TempDir(), "image.bin") + "?i2c=0x68")
+	if err := a.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	found, err := a.ScanI2C(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57, 0x68}
+	if !bytes.Equal(found, expected) {
+		t.Fatalf("Expected % X, got % X", expected, found)
+	}
+
+	old := NewArduino93L56R(simulatedPortPrefix + filepath.Join(t.TempDir(), "image.bin") + "?protocol=5")
+	if err := old.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer old.Close()
+	if _, err := old.ScanI2C(context.Background()); err == nil {
+		t.Fatal("Expected an error scanning with a sketch which can not probe, got none")
+	}
+}
+
+func TestI2CPageSize(t *testing.T) {
+	a := NewArduino93L56R(simulatedPortPrefix + filepath.Join(t.TempDir(), "image.bin"))
+	a.SetI2CPageSize(16)
+	var progress []int
+	a.SetProgress(func(done, total int) {
+		progress = append(progress, done)
+	})
+	if err := a.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	buf := bytes.Repeat([]byte{0x24}, 40)
+	if err := a.Write(context.Background(), 0x1C, buf, I2C); err != nil {
+		t.Fatal(err)
+	}
+	// One write up to each page boundary
+	expected := []int{0, 4, 20, 36, 40}
+	if len(progress) != len(expected) {
+		t.Fatalf("Expected progress %v, got %v", expected, progress)
+	}
+	for i := range expected {
+		if progress[i] != expected[i] {
+			t.Fatalf("Expected progress %v, got %v", expected, progress)
+		}
+	}
+
+	read, err := a.Read(context.Background(), 0x1C, len(buf), I2C)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, buf) {
+		t.Fatalf("Expected % X, got % X", buf, read)
+	}
+}
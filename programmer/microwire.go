@@ -0,0 +1,207 @@
+package programmer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rgeyer/93l56r-cli/programmer/protocol"
+)
+
+// The organization and address bits of the 93L56R, which every sketch before
+// protocol version 7 assumes.
+const (
+	DefaultMicrowireOrganization = 16
+	DefaultMicrowireAddressBits  = 8
+)
+
+// The range of address bits used by the 93C46 to 93C86 in either organization.
+const (
+	minMicrowireAddressBits = 6
+	maxMicrowireAddressBits = 11
+)
+
+// SetMicrowireOrganization sets the organization of the Microwire EEPROM, 16
+// bits per address when its ORG pin is high, or 8 when it is low.
+func (a *Arduino93L56R) SetMicrowireOrganization(wordBits int) {
+	a.microwireOrganization = wordBits
+}
+
+// SetMicrowireAddressBits sets how many address bits the Microwire EEPROM
+// expects after each opcode. I.E. 6 for the 93C46 organized as x16, or 7 as
+// x8, up to 10 and 11 for the 93C86.
+func (a *Arduino93L56R) SetMicrowireAddressBits(n int) {
+	a.microwireAddressBits = n
+}
+
+// WordSize returns the number of bytes at each address of EEPROMs of icType.
+// For Microwire EEPROMs it depends on their organization.
+func (a *Arduino93L56R) WordSize(icType IcType) int {
+	if icType == Microwire {
+		return a.microwireOrganization / 8
+	}
+	return icType.WordSize()
+}
+
+// microwireHeader returns the start of a Microwire request, see
+// protocol.MicrowireHeader.
+func (a *Arduino93L56R) microwireHeader(cmd byte, addr int, length int) []byte {
+	return protocol.MicrowireHeader(cmd, a.protocol, a.microwireOrganization, a.microwireAddressBits, addr, length)
+}
+
+// checkMicrowireRange returns an error if the length bytes starting at addr
+// can not be reached with the organization and address bits, or the sketch
+// can not send them.
+func (a *Arduino93L56R) checkMicrowireRange(addr int, length int) error {
+	if a.microwireOrganization != 8 && a.microwireOrganization != 16 {
+		return fmt.Errorf("Microwire EEPROMs are organized as 8 or 16 bits per address, not %d", a.microwireOrganization)
+	}
+	if a.microwireAddressBits < minMicrowireAddressBits || a.microwireAddressBits > maxMicrowireAddressBits {
+		return fmt.Errorf("Microwire EEPROMs use %d to %d address bits, not %d", minMicrowireAddressBits, maxMicrowireAddressBits, a.microwireAddressBits)
+	}
+	if a.protocol < 7 && (a.microwireOrganization != DefaultMicrowireOrganization || a.microwireAddressBits != DefaultMicrowireAddressBits) {
+		return fmt.Errorf("The programmer firmware only supports x16 Microwire EEPROMs with 8 address bits. Protocol version 7 is needed for others, it supports version %d", a.protocol)
+	}
+
+	wordSize := a.WordSize(Microwire)
+	if length%wordSize != 0 {
+		return fmt.Errorf("The length must be a multiple of %d bytes for x%d Microwire EEPROMs, not %d", wordSize, a.microwireOrganization, length)
+	}
+	limit := 1 << uint(a.microwireAddressBits)
+	if end := addr + length/wordSize - 1; addr < 0 || end >= limit {
+		return fmt.Errorf("Address 0x%X is out of range for Microwire EEPROMs with %d address bits", end, a.microwireAddressBits)
+	}
+	return nil
+}
+
+// eraseChunkLen is the most bytes erased by each erase request. Each word
+// takes the EEPROM a few milliseconds to erase, so the sketch answers well
+// within the response timeout.
+const eraseChunkLen = 64
+
+// checkMicrowireControl returns an error if the sketch can not send the
+// write-enable, erase and write all instructions.
+func (a *Arduino93L56R) checkMicrowireControl() error {
+	if err := a.caps.checkSupports(Microwire); err != nil {
+		return err
+	}
+	if a.protocol < 8 {
+		return fmt.Errorf("The programmer firmware can not write-enable, write-disable or erase Microwire EEPROMs. Protocol version 8 is needed, it supports version %d", a.protocol)
+	}
+	return a.checkMicrowireRange(0, 0)
+}
+
+// CanControlMicrowire reports whether the sketch connected to can send the
+// write-enable, erase and write all instructions.
+func (a *Arduino93L56R) CanControlMicrowire() bool {
+	return a.caps.Supports(Microwire) && a.protocol >= 8
+}
+
+// microwireControl sends the request, which is acknowledged without a
+// payload.
+func (a *Arduino93L56R) microwireControl(ctx context.Context, request []byte) error {
+	response, err := a.request(ctx, request)
+	if err != nil {
+		return err
+	}
+	if err := protocol.ParseWriteAck(response); err != nil {
+		return newProtocolError(request[0], response, err)
+	}
+	return nil
+}
+
+// WriteEnableMicrowire sends the EWEN instruction to the Microwire EEPROM if
+// enable is true, or EWDS otherwise. Write, EraseMicrowire,
+// EraseAllMicrowire and WriteAllMicrowire enable writes themselves, and
+// always disable them again, so this is only needed to leave the EEPROM
+// write-enabled on purpose.
+func (a *Arduino93L56R) WriteEnableMicrowire(ctx context.Context, enable bool) error {
+	if err := a.checkMicrowireControl(); err != nil {
+		return err
+	}
+	return a.microwireControl(ctx, protocol.MicrowireWriteEnableRequest(a.microwireOrganization, a.microwireAddressBits, enable))
+}
+
+// withMicrowireWrites runs op with the Microwire EEPROM write-enabled, and
+// write-disables it afterwards, even when op or the write-enable request fail
+// or ctx is done. Sketches before protocol version 8 enable writes themselves,
+// so op is just run. If the EEPROM could not be write-disabled the error is a
+// *WriteDisableError.
+func (a *Arduino93L56R) withMicrowireWrites(ctx context.Context, op func() error) error {
+	if a.protocol < 8 {
+		return op()
+	}
+	// The sketch may have run EWEN even if its ack was lost or ctx was done
+	// while waiting for it, so the EEPROM is write-disabled either way.
+	err := a.microwireControl(ctx, protocol.MicrowireWriteEnableRequest(a.microwireOrganization, a.microwireAddressBits, true))
+	if err == nil {
+		err = op()
+	}
+	// Not cancelled along with op, so the EEPROM is not left write-enabled
+	disableErr := a.microwireControl(context.Background(), protocol.MicrowireWriteEnableRequest(a.microwireOrganization, a.microwireAddressBits, false))
+	if disableErr != nil {
+		return &WriteDisableError{Err: err, DisableErr: disableErr}
+	}
+	return err
+}
+
+// EraseMicrowire sets the length bytes starting at addr to 0xFF with the
+// ERASE instruction. If it is stopped part way through, the error is a
+// *PartialWriteError.
+func (a *Arduino93L56R) EraseMicrowire(ctx context.Context, addr int, length int) error {
+	if err := a.checkMicrowireControl(); err != nil {
+		return err
+	}
+	if err := a.checkMicrowireRange(addr, length); err != nil {
+		return err
+	}
+
+	wordSize := a.WordSize(Microwire)
+	return a.withMicrowireWrites(ctx, func() error {
+		a.reportProgress(0, length)
+		for offset := 0; offset < length; {
+			chunkAddr := addr + offset/wordSize
+			end := offset + eraseChunkLen
+			if end > length {
+				end = length
+			}
+			if err := ctx.Err(); err != nil {
+				return &PartialWriteError{Addr: chunkAddr, Written: offset, Total: length, Err: err}
+			}
+			// Not cancelled along with the erase, see Write
+			if err := a.microwireControl(context.Background(), a.microwireHeader(protocol.MicrowireErase, chunkAddr, end-offset)); err != nil {
+				if offset == 0 {
+					return err
+				}
+				return &PartialWriteError{Addr: chunkAddr, Written: offset, Total: length, Err: err}
+			}
+			a.reportProgress(end, length)
+			offset = end
+		}
+		return nil
+	})
+}
+
+// EraseAllMicrowire sets every byte of the Microwire EEPROM to 0xFF with the
+// ERAL instruction.
+func (a *Arduino93L56R) EraseAllMicrowire(ctx context.Context) error {
+	if err := a.checkMicrowireControl(); err != nil {
+		return err
+	}
+	return a.withMicrowireWrites(ctx, func() error {
+		return a.microwireControl(ctx, protocol.MicrowireEraseAllRequest(a.microwireOrganization, a.microwireAddressBits))
+	})
+}
+
+// WriteAllMicrowire writes word to every address of the Microwire EEPROM with
+// the WRAL instruction. word must hold exactly one word of the organization.
+func (a *Arduino93L56R) WriteAllMicrowire(ctx context.Context, word []byte) error {
+	if err := a.checkMicrowireControl(); err != nil {
+		return err
+	}
+	if len(word) != a.WordSize(Microwire) {
+		return fmt.Errorf("The word to write must be %d bytes for x%d Microwire EEPROMs, not %d", a.WordSize(Microwire), a.microwireOrganization, len(word))
+	}
+	return a.withMicrowireWrites(ctx, func() error {
+		return a.microwireControl(ctx, protocol.MicrowireWriteAllRequest(a.microwireOrganization, a.microwireAddressBits, word))
+	})
+}
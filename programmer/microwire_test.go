@@ -0,0 +1,219 @@
+package programmer
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/rgeyer/93l56r-cli/programmer/protocol"
+)
+
+func TestMicrowireOrganization(t *testing.T) {
+	cases := []struct {
+		name      string
+		options   string
+		wordBits  int
+		addrBits  int
+		addr      int
+		length    int
+		offset    int
+		expectErr bool
+	}{
+		{"x16", "", 16, 8, 0x7E, 4, 0xFC, false},
+		{"x8", "", 8, 11, 0x7FC, 4, 0x7FC, false},
+		{"x16 93C46", "", 16, 6, 0x3E, 4, 0x7C, false},
+		{"x16 out of range", "", 16, 6, 0x3F, 4, 0, true},
+		{"odd length", "", 16, 8, 0x10, 3, 0, true},
+		{"x8 on an old sketch", "?protocol=6", 8, 9, 0x10, 4, 0, true},
+		{"x16 on an old sketch", "?protocol=6", 16, 8, 0x10, 4, 0x20, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			image := filepath.Join(t.TempDir(), "image.bin")
+			a := NewArduino93L56R(simulatedPortPrefix + image + c.options)
+			a.SetMicrowireOrganization(c.wordBits)
+			a.SetMicrowireAddressBits(c.addrBits)
+			if err := a.Connect(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			defer a.Close()
+
+			buf := []byte{0x93, 0xC8, 0x60, 0x01}[:c.length]
+			err := a.Write(context.Background(), c.addr, buf, Microwire)
+			if c.expectErr {
+				if err == nil {
+					t.Fatal("Expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			read, err := a.Read(context.Background(), c.addr, len(buf), Microwire)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(read, buf) {
+				t.Fatalf("Expected % X, got % X", buf, read)
+			}
+			saved, err := ioutil.ReadFile(image)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(saved) != c.offset+len(buf) || !bytes.Equal(saved[c.offset:], buf) {
+				t.Fatalf("Expected the image to hold the buffer at 0x%X, got\n% X", c.offset, saved)
+			}
+		})
+	}
+}
+
+// newMicrowireArduino returns a connected simulated Arduino, with the x16
+// EEPROM image filled with 0xA5.
+func newMicrowireArduino(t *testing.T, options string) *Arduino93L56R {
+	a := NewArduino93L56R(simulatedPortPrefix + filepath.Join(t.TempDir(), "image.bin") + options)
+	if err := a.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(a.Close)
+	if err := a.Write(context.Background(), 0, bytes.Repeat([]byte{0xA5}, 512), Microwire); err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestEraseMicrowire(t *testing.T) {
+	a := newMicrowireArduino(t, "")
+	if a.sim.microwireWriteEnabled {
+		t.Fatal("Expected the EEPROM to have been write-disabled after writing")
+	}
+
+	if err := a.EraseMicrowire(context.Background(), 0x10, 200); err != nil {
+		t.Fatal(err)
+	}
+	if a.sim.microwireWriteEnabled {
+		t.Fatal("Expected the EEPROM to have been write-disabled after erasing")
+	}
+	read, err := a.Read(context.Background(), 0, 512, Microwire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := bytes.Repeat([]byte{0xA5}, 512)
+	copy(expected[0x20:], bytes.Repeat([]byte{0xFF}, 200))
+	if !bytes.Equal(read, expected) {
+		t.Fatalf("Expected only 200 bytes from 0x10 to be erased, got\n% X", read)
+	}
+
+	if err := a.EraseMicrowire(context.Background(), 0x10, 3); err == nil {
+		t.Fatal("Expected an error erasing part of a word, got none")
+	}
+}
+
+func TestEraseAllAndWriteAllMicrowire(t *testing.T) {
+	a := newMicrowireArduino(t, "")
+
+	if err := a.WriteAllMicrowire(context.Background(), []byte{0x12, 0x34}); err != nil {
+		t.Fatal(err)
+	}
+	read, err := a.Read(context.Background(), 0, 512, Microwire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, bytes.Repeat([]byte{0x12, 0x34}, 256)) {
+		t.Fatalf("Expected every word to be 0x1234, got\n% X", read)
+	}
+
+	if err := a.EraseAllMicrowire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	read, err = a.Read(context.Background(), 0, 512, Microwire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, bytes.Repeat([]byte{0xFF}, 512)) {
+		t.Fatalf("Expected every byte to be erased, got\n% X", read)
+	}
+	if a.sim.microwireWriteEnabled {
+		t.Fatal("Expected the EEPROM to have been write-disabled")
+	}
+
+	if err := a.WriteAllMicrowire(context.Background(), []byte{0x12}); err == nil {
+		t.Fatal("Expected an error writing a byte to every x16 word, got none")
+	}
+}
+
+func TestEraseAllKeepsImageSize(t *testing.T) {
+	image := filepath.Join(t.TempDir(), "image.bin")
+	if err := ioutil.WriteFile(image, bytes.Repeat([]byte{0xA5}, 256), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a := NewArduino93L56R(simulatedPortPrefix + image)
+	if err := a.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	if err := a.WriteAllMicrowire(context.Background(), []byte{0x12, 0x34}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.EraseAllMicrowire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := ioutil.ReadFile(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(saved, bytes.Repeat([]byte{0xFF}, 256)) {
+		t.Fatalf("Expected the 256 byte image to have been erased, got %d bytes\n% X", len(saved), saved)
+	}
+}
+
+func TestWriteEnableMicrowire(t *testing.T) {
+	a := newMicrowireArduino(t, "")
+	if err := a.WriteEnableMicrowire(context.Background(), true); err != nil {
+		t.Fatal(err)
+	}
+	if !a.sim.microwireWriteEnabled {
+		t.Fatal("Expected the EEPROM to have been write-enabled")
+	}
+	if err := a.WriteEnableMicrowire(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	if a.sim.microwireWriteEnabled {
+		t.Fatal("Expected the EEPROM to have been write-disabled")
+	}
+
+	if !a.CanControlMicrowire() {
+		t.Fatal("Expected the sketch to be able to control the EEPROM")
+	}
+	old := newMicrowireArduino(t, "?protocol=7")
+	if old.CanControlMicrowire() {
+		t.Fatal("Expected a protocol version 7 sketch to be unable to control the EEPROM")
+	}
+	if err := old.WriteEnableMicrowire(context.Background(), false); err == nil {
+		t.Fatal("Expected an error write-disabling with a sketch which can not, got none")
+	}
+	if err := old.EraseAllMicrowire(context.Background()); err == nil {
+		t.Fatal("Expected an error erasing with a sketch which can not, got none")
+	}
+}
+
+func TestSimulatorRejectsMicrowireGeometry(t *testing.T) {
+	a := newMicrowireArduino(t, "")
+	requests := [][]byte{
+		protocol.MicrowireEraseAllRequest(32, 8),
+		protocol.MicrowireEraseAllRequest(16, 200),
+		protocol.MicrowireWriteAllRequest(8, 60, []byte{0x00}),
+		protocol.MicrowireWriteAllRequest(16, 8, []byte{0x00}),
+	}
+	for _, request := range requests {
+		if _, err := a.request(context.Background(), request); err == nil {
+			t.Errorf("Expected an error for the request % X, got none", request)
+		} else if _, ok := err.(*ProtocolError); !ok {
+			t.Errorf("Expected a *ProtocolError for the request % X, got %v", request, err)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package programmer
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rgeyer/93l56r-cli/programmer/protocol"
+)
+
+// ProtocolVersion is the newest version of the serial protocol supported.
+const ProtocolVersion = protocol.Version
+
+// ProtocolError is returned when the Arduino does not respond to a request
+// with the expected packet.
+type ProtocolError struct {
+	// Request is the name of the request which was not answered as expected.
+	Request string
+	Reason  string
+	// Packet is the unexpected response, if there was one.
+	Packet []byte
+	// Timeout is true if there was no response at all.
+	Timeout bool
+	// Err is the error from the protocol package which caused this error, if
+	// there was one. I.E. a *protocol.CommandError
+	Err error
+}
+
+func (e *ProtocolError) Error() string {
+	msg := fmt.Sprintf("Arduino did not respond as expected to %s request. %s", e.Request, e.Reason)
+	if len(e.Packet) > 0 {
+		msg += fmt.Sprintf("\n\nResponse:\n%s", hex.Dump(e.Packet))
+	}
+	return msg
+}
+
+func newProtocolError(request byte, packet []byte, err error) *ProtocolError {
+	return &ProtocolError{Request: protocol.CommandName(request), Reason: err.Error(), Packet: packet, Err: err}
+}
+
+// sealLen is how much longer protocol.Seal makes a packet.
+const sealLen = 3
+
+// maxRetransmits is how many times a request is sent again from protocol
+// version 3 when it, or its response, arrives corrupted.
+const maxRetransmits = 3
+
+// DefaultResponseTimeout is how long to wait for the Arduino to respond to a
+// request, unless SetResponseTimeout is used.
+const DefaultResponseTimeout = 5 * time.Second
+
+// resetAttempts is how many reset requests Connect sends before giving up.
+const resetAttempts = 50
+
+// resetTimeout is how long Connect waits for each of its reset requests to be
+// acknowledged before sending another.
+const resetTimeout = 200 * time.Millisecond
+
+// pollInterval is how long to sleep between reads which returned nothing.
+const pollInterval = 100 * time.Millisecond
+
+// maxChunkRetries is how many times Read requests a chunk again when its
+// response is lost or corrupted.
+const maxChunkRetries = 3
+
+var errNoResponse = errors.New("no response")
+
+// sleep pauses for d, or until ctx is done, in which case its error is
+// returned.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// timeoutError returns the error for a request which was not answered in
+// time.
+func timeoutError(request byte) *ProtocolError {
+	return &ProtocolError{Request: protocol.CommandName(request), Reason: "Timed out waiting for a response.", Timeout: true}
+}
+
+// send encodes packet and writes it to the Arduino.
+func (a *Arduino93L56R) send(packet []byte) error {
+	packetBytes := protocol.Encode(packet)
+	if len(packetBytes) > a.caps.BufferSize {
+		return fmt.Errorf("The resulting COBS packet for the %s request exceeds %d bytes and will overflow the Arduino Serial buffer. Actual size was %d", protocol.CommandName(packet[0]), a.caps.BufferSize, len(packetBytes))
+	}
+
+	wroteBytes, err := a.serial.Write(packetBytes)
+	if wroteBytes != len(packetBytes) || err != nil {
+		return fmt.Errorf("Unable to send %s request. Expected %d bytes written, got %d. Error: %s", protocol.CommandName(packet[0]), len(packetBytes), wroteBytes, err)
+	}
+	return nil
+}
+
+// request sends packet, and returns the payload of the response. From
+// protocol version 3 the packet is sealed with a sequence number and CRC, and
+// sent again if either it or the response arrive corrupted.
+func (a *Arduino93L56R) request(ctx context.Context, packet []byte) ([]byte, error) {
+	if a.protocol < 3 {
+		if err := a.send(packet); err != nil {
+			return nil, err
+		}
+		return a.readPacket(ctx, packet[0], a.responseTimeout)
+	}
+
+	a.seq++
+	var lastErr error
+	for attempt := 0; attempt <= maxRetransmits; attempt++ {
+		if attempt > 0 {
+			fmt.Printf("Retransmitting %s request. %s\n", protocol.CommandName(packet[0]), lastErr)
+			a.discardInput()
+		}
+		if err := a.send(protocol.Seal(packet, a.seq)); err != nil {
+			return nil, err
+		}
+
+		payload, err := a.readSealedPacket(ctx, packet[0], a.seq, a.responseTimeout)
+		if _, ok := err.(*ProtocolError); ok {
+			lastErr = err
+			continue
+		}
+		return payload, err
+	}
+	return nil, lastErr
+}
+
+// discardInput throws away anything received which has not been read yet,
+// such as the rest of a corrupted response.
+func (a *Arduino93L56R) discardInput() {
+	a.partial = nil
+	a.reader.Discard(a.reader.Buffered())
+}
+
+// readFrame waits for the next COBS frame from the Arduino, including its
+// 0x00 delimiter, until nothing has been received for timeout, or ctx is done.
+// Bytes of a frame which has not been completely received yet are kept for
+// the next call.
+//
+// The serial port is opened with an inter character timeout, so reads return
+// promptly even when nothing arrives, and ctx is checked between them.
+func (a *Arduino93L56R) readFrame(ctx context.Context, timeout time.Duration) ([]byte, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		readBytes, err := a.reader.ReadBytes(protocol.Delimiter)
+		a.partial = append(a.partial, readBytes...)
+		if len(readBytes) > 0 {
+			deadline = time.Now().Add(timeout)
+		}
+		if err != nil && (err == io.EOF || strings.Contains(err.Error(), "multiple Read calls")) {
+			if !time.Now().Before(deadline) {
+				return nil, errNoResponse
+			}
+			if err := sleep(ctx, pollInterval); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		frame := a.partial
+		a.partial = nil
+		return frame, nil
+	}
+}
+
+// readPacket waits for the response to the request command, and returns its
+// payload, which follows the command byte. Acknowledgements of earlier reset
+// requests are skipped, since Connect may have sent several of them.
+func (a *Arduino93L56R) readPacket(ctx context.Context, request byte, timeout time.Duration) ([]byte, error) {
+	for {
+		frame, err := a.readFrame(ctx, timeout)
+		if err == errNoResponse {
+			return nil, timeoutError(request)
+		}
+		if err != nil && err == ctx.Err() {
+			return nil, err
+		}
+		if err != nil {
+			return nil, newProtocolError(request, nil, err)
+		}
+
+		if request != protocol.Reset && protocol.IsResetAck(frame) {
+			continue
+		}
+		payload, err := protocol.ParseResponse(frame, request)
+		if err != nil {
+			return nil, newProtocolError(request, frame, err)
+		}
+		return payload, nil
+	}
+}
+
+// readSealedPacket is readPacket for protocol version 3, where responses are
+// sealed with the sequence number seq of the request. Late responses to
+// earlier requests are skipped.
+func (a *Arduino93L56R) readSealedPacket(ctx context.Context, request byte, seq byte, timeout time.Duration) ([]byte, error) {
+	for {
+		frame, err := a.readFrame(ctx, timeout)
+		if err == errNoResponse {
+			return nil, timeoutError(request)
+		}
+		if err != nil && err == ctx.Err() {
+			return nil, err
+		}
+		if err != nil {
+			return nil, newProtocolError(request, nil, err)
+		}
+
+		if protocol.IsResetAck(frame) {
+			continue
+		}
+		payload, err := protocol.ParseSealedResponse(frame, request, seq)
+		if serr, ok := err.(*protocol.SequenceError); ok && int8(serr.Expected-serr.Got) > 0 {
+			continue
+		}
+		if err != nil {
+			return nil, newProtocolError(request, frame, err)
+		}
+		return payload, nil
+	}
+}
+
+// readRaw reads the length unframed bytes version 1 sketches respond to read
+// requests with, until nothing has been received for timeout, or ctx is done.
+func (a *Arduino93L56R) readRaw(ctx context.Context, request byte, length int, timeout time.Duration) ([]byte, error) {
+	buf := make([]byte, length)
+	byteCnt := copy(buf, a.partial)
+	a.partial = a.partial[byteCnt:]
+
+	deadline := time.Now().Add(timeout)
+	for byteCnt < length && time.Now().Before(deadline) {
+		cnt, err := a.reader.Read(buf[byteCnt:])
+		byteCnt += cnt
+		if err != nil && err != io.EOF {
+			return nil, newProtocolError(request, buf[:byteCnt], err)
+		}
+		if cnt > 0 {
+			deadline = time.Now().Add(timeout)
+			continue
+		}
+		if err := sleep(ctx, pollInterval); err != nil {
+			return nil, err
+		}
+	}
+
+	if byteCnt != length {
+		return nil, &ProtocolError{Request: protocol.CommandName(request), Reason: fmt.Sprintf("Did not receive all bytes from EEPROM read. Expected %d bytes, got %d.", length, byteCnt), Packet: buf[:byteCnt], Timeout: true}
+	}
+	return buf, nil
+}
@@ -0,0 +1,33 @@
+package programmer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/rgeyer/93l56r-cli/programmer/protocol"
+)
+
+func FuzzReadPacket(f *testing.F) {
+	f.Add([]byte{0x02, 0x80, 0x00, 0x02, 0x82, 0x00}, protocol.MicrowireWrite)
+	f.Add([]byte{0x03, 0x80, 0x02, 0x00}, protocol.Reset)
+	f.Add([]byte{0x00, 0x00}, protocol.Reset)
+	f.Add([]byte{0x05, 0x81, 0x00}, protocol.MicrowireRead)
+
+	f.Fuzz(func(t *testing.T, responses []byte, request byte) {
+		a := &Arduino93L56R{reader: bufio.NewReader(bytes.NewReader(responses))}
+		for {
+			payload, err := a.readPacket(context.Background(), request, 0)
+			if err != nil {
+				if _, ok := err.(*ProtocolError); !ok {
+					t.Fatalf("Expected a *ProtocolError, got %T", err)
+				}
+				return
+			}
+			if request == protocol.Reset {
+				protocol.ParseResetAck(payload)
+			}
+		}
+	})
+}
@@ -0,0 +1,147 @@
+// Package programmer provides access to serial EEPROMs through a hardware
+// programmer, such as an Arduino running the subaru immo sketch.
+package programmer
+
+import (
+	"context"
+	"fmt"
+)
+
+// IcType is the bus used to talk to the EEPROM.
+type IcType string
+
+const (
+	Microwire IcType = "microwire"
+	I2C       IcType = "i2c"
+)
+
+// WordSize returns the number of bytes at each address of EEPROMs of type t,
+// when Microwire EEPROMs are organized as x16.
+func (t IcType) WordSize() int {
+	if t == Microwire {
+		return 2
+	}
+	return 1
+}
+
+// Programmer reads and writes the contents of an EEPROM.
+//
+// For Microwire EEPROMs addr is a word address, of 16 or 8 bits depending on
+// their organization, for I2C EEPROMs it is a byte address, see WordSize.
+// Lengths and buffers are always in bytes.
+//
+// Every operation gives up once ctx is done, I.E. when its deadline passes or
+// the user presses Ctrl-C.
+type Programmer interface {
+	// Connect opens the connection to the programmer and resets it.
+	Connect(ctx context.Context) error
+	// Capabilities returns what the programmer firmware can do. It is only
+	// known once connected.
+	Capabilities() Capabilities
+	// BaudRate returns the rate the connection is running at.
+	BaudRate() int
+	// Read returns length bytes from the EEPROM starting at addr. If it is
+	// stopped part way through, the error is a *PartialReadError holding
+	// what was read.
+	Read(ctx context.Context, addr int, length int, icType IcType) ([]byte, error)
+	// Write stores buf in the EEPROM starting at addr. If it is stopped part
+	// way through, the error is a *PartialWriteError.
+	Write(ctx context.Context, addr int, buf []byte, icType IcType) error
+	// WordSize returns the number of bytes at each address of EEPROMs of
+	// icType.
+	WordSize(icType IcType) int
+	// Close releases the connection to the programmer.
+	Close()
+}
+
+// MicrowireController is implemented by programmers which can send the
+// Microwire write-enable, erase and write all instructions. Not every
+// programmer can, so commands check for it.
+type MicrowireController interface {
+	// CanControlMicrowire reports whether the programmer connected to can
+	// send these instructions, which older firmware can not.
+	CanControlMicrowire() bool
+	// WriteEnableMicrowire sends the EWEN, or EWDS, instruction to the
+	// Microwire EEPROM. Every write and erase leaves it write-disabled.
+	WriteEnableMicrowire(ctx context.Context, enable bool) error
+	// EraseMicrowire sets length bytes starting at addr to 0xFF. If it is
+	// stopped part way through, the error is a *PartialWriteError.
+	EraseMicrowire(ctx context.Context, addr int, length int) error
+	// EraseAllMicrowire sets every byte of the Microwire EEPROM to 0xFF.
+	EraseAllMicrowire(ctx context.Context) error
+	// WriteAllMicrowire writes the single word to every address of the
+	// Microwire EEPROM.
+	WriteAllMicrowire(ctx context.Context, word []byte) error
+}
+
+// I2CScanner is implemented by programmers which can probe the I2C bus.
+type I2CScanner interface {
+	// ScanI2C returns the address of every device on the I2C bus.
+	ScanI2C(ctx context.Context) ([]byte, error)
+}
+
+var _ Programmer = (*Arduino93L56R)(nil)
+var _ MicrowireController = (*Arduino93L56R)(nil)
+var _ I2CScanner = (*Arduino93L56R)(nil)
+
+// PartialWriteError is returned when a write stopped after some, but not all
+// of the buffer was written.
+type PartialWriteError struct {
+	// Addr is the first address which was not written.
+	Addr int
+	// Written is how many bytes of the buffer were written, Total is its length.
+	Written int
+	Total   int
+	// Err is the reason the write stopped. I.E. context.Canceled
+	Err error
+}
+
+func (e *PartialWriteError) Error() string {
+	return fmt.Sprintf("Stopped after writing %d of %d bytes, the EEPROM from address 0x%04X onwards may not have been written. %s", e.Written, e.Total, e.Addr, e.Err)
+}
+
+func (e *PartialWriteError) Unwrap() error {
+	return e.Err
+}
+
+// WriteDisableError is returned when the Microwire EEPROM could not be
+// write-disabled after writing or erasing it, so it may still be
+// write-enabled.
+type WriteDisableError struct {
+	// Err is why the write or erase failed, or nil if it succeeded.
+	Err error
+	// DisableErr is why the EEPROM could not be write-disabled.
+	DisableErr error
+}
+
+func (e *WriteDisableError) Error() string {
+	msg := fmt.Sprintf("Unable to write-disable the EEPROM, it may still be write-enabled. Error: %s", e.DisableErr)
+	if e.Err != nil {
+		return fmt.Sprintf("%s. %s", e.Err, msg)
+	}
+	return msg
+}
+
+func (e *WriteDisableError) Unwrap() error {
+	return e.Err
+}
+
+// PartialReadError is returned when a read stopped after some, but not all of
+// the requested bytes were read.
+type PartialReadError struct {
+	// Addr is the first address which was not read.
+	Addr int
+	// Data is what was read before stopping, Total the length requested.
+	Data  []byte
+	Total int
+	// Err is the reason the read stopped. I.E. context.Canceled
+	Err error
+}
+
+func (e *PartialReadError) Error() string {
+	return fmt.Sprintf("Stopped after reading %d of %d bytes, at address 0x%04X. %s", len(e.Data), e.Total, e.Addr, e.Err)
+}
+
+func (e *PartialReadError) Unwrap() error {
+	return e.Err
+}
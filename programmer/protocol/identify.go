@@ -0,0 +1,74 @@
+package protocol
+
+import "fmt"
+
+// Bits of Identity.Buses, set for each bus the sketch can drive.
+const (
+	BusMicrowire byte = 0x01
+	BusI2C       byte = 0x02
+)
+
+// identityHeaderLen is the length of the fixed part of an Identify response,
+// before the list of baud rates.
+const identityHeaderLen = 6
+
+// Identity is the payload of the response to an Identify request, which is
+// laid out as
+//
+//	firmware major, firmware minor, buffer size (2 bytes), buses,
+//	baud rate count, baud rates (4 bytes each)
+//
+// with every multi byte value most significant byte first.
+type Identity struct {
+	FirmwareMajor int
+	FirmwareMinor int
+	// BufferSize is the size of the sketch serial buffer. No encoded request
+	// may be longer.
+	BufferSize int
+	// Buses is a combination of BusMicrowire and BusI2C.
+	Buses     byte
+	BaudRates []int
+}
+
+// Payload returns the Identify response payload describing id.
+func (id *Identity) Payload() []byte {
+	payload := []byte{
+		byte(id.FirmwareMajor),
+		byte(id.FirmwareMinor),
+		byte(id.BufferSize >> 8),
+		byte(id.BufferSize & 0xFF),
+		id.Buses,
+		byte(len(id.BaudRates)),
+	}
+	for _, baud := range id.BaudRates {
+		payload = append(payload, byte(baud>>24), byte(baud>>16), byte(baud>>8), byte(baud&0xFF))
+	}
+	return payload
+}
+
+// ParseIdentity returns the Identity held in the payload of an Identify
+// response.
+func ParseIdentity(payload []byte) (*Identity, error) {
+	if len(payload) < identityHeaderLen {
+		return nil, &LengthError{Expected: identityHeaderLen, Got: len(payload)}
+	}
+	baudCount := int(payload[5])
+	if expected := identityHeaderLen + baudCount*4; len(payload) != expected {
+		return nil, &LengthError{Expected: expected, Got: len(payload)}
+	}
+
+	id := &Identity{
+		FirmwareMajor: int(payload[0]),
+		FirmwareMinor: int(payload[1]),
+		BufferSize:    int(payload[2])<<8 | int(payload[3]),
+		Buses:         payload[4],
+	}
+	if id.BufferSize < 16 {
+		return nil, fmt.Errorf("The sketch reported a serial buffer of only %d bytes.", id.BufferSize)
+	}
+	for i := 0; i < baudCount; i++ {
+		b := payload[identityHeaderLen+i*4:]
+		id.BaudRates = append(id.BaudRates, int(b[0])<<24|int(b[1])<<16|int(b[2])<<8|int(b[3]))
+	}
+	return id, nil
+}
@@ -0,0 +1,34 @@
+package protocol
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseIdentity(t *testing.T) {
+	id := &Identity{
+		FirmwareMajor: 1,
+		FirmwareMinor: 2,
+		BufferSize:    256,
+		Buses:         BusMicrowire | BusI2C,
+		BaudRates:     []int{9600, 115200},
+	}
+	parsed, err := ParseIdentity(id.Payload())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, id) {
+		t.Fatalf("Expected %+v, got %+v", id, parsed)
+	}
+
+	cases := map[string][]byte{
+		"short":         {1, 0, 0, 64, BusI2C},
+		"missing bauds": {1, 0, 0, 64, BusI2C, 1, 0, 0},
+		"tiny buffer":   {1, 0, 0, 8, BusI2C, 0},
+	}
+	for name, payload := range cases {
+		if _, err := ParseIdentity(payload); err == nil {
+			t.Errorf("Expected an error parsing the %s payload % X, got none", name, payload)
+		}
+	}
+}
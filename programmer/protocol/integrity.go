@@ -0,0 +1,105 @@
+package protocol
+
+import "fmt"
+
+// Nak is the command byte of the response sent from protocol version 3 when
+// a request arrives with a bad checksum. The request should be sent again.
+const Nak byte = 0xFF
+
+// ChecksumError is returned when the CRC of a packet does not match its
+// contents.
+type ChecksumError struct {
+	Expected uint16
+	Got      uint16
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("Expected checksum 0x%04X, got 0x%04X.", e.Expected, e.Got)
+}
+
+// SequenceError is returned when a response does not carry the sequence
+// number of the request it should answer.
+type SequenceError struct {
+	Expected byte
+	Got      byte
+}
+
+func (e *SequenceError) Error() string {
+	return fmt.Sprintf("Expected sequence number %d, got %d.", e.Expected, e.Got)
+}
+
+// NakError is returned when the Arduino reports a request arrived corrupted.
+type NakError struct{}
+
+func (e *NakError) Error() string {
+	return "The request arrived corrupted."
+}
+
+// CRC16 returns the CRC-16/CCITT-FALSE checksum of data.
+func CRC16(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// Seal returns packet as sent from protocol version 3, with the sequence
+// number seq inserted after the command byte, and the CRC16 of the result
+// appended most significant byte first.
+func Seal(packet []byte, seq byte) []byte {
+	sealed := make([]byte, 0, len(packet)+3)
+	if len(packet) > 0 {
+		sealed = append(sealed, packet[0], seq)
+		sealed = append(sealed, packet[1:]...)
+	}
+	crc := CRC16(sealed)
+	return append(sealed, byte(crc>>8), byte(crc&0xFF))
+}
+
+// Open checks the CRC of a packet created by Seal, and returns the original
+// packet and its sequence number.
+func Open(sealed []byte) ([]byte, byte, error) {
+	if len(sealed) < 4 {
+		return nil, 0, &LengthError{Expected: 4, Got: len(sealed)}
+	}
+	body := sealed[:len(sealed)-2]
+	got := uint16(sealed[len(sealed)-2])<<8 | uint16(sealed[len(sealed)-1])
+	if expected := CRC16(body); got != expected {
+		return nil, 0, &ChecksumError{Expected: expected, Got: got}
+	}
+
+	packet := append([]byte{body[0]}, body[2:]...)
+	return packet, body[1], nil
+}
+
+// ParseSealedResponse decodes frame, checks its CRC, checks it carries the
+// sequence number seq, and acknowledges the request command, and returns its
+// payload, which follows the command byte.
+func ParseSealedResponse(frame []byte, request byte, seq byte) ([]byte, error) {
+	sealed, err := Decode(frame)
+	if err != nil {
+		return nil, err
+	}
+	packet, got, err := Open(sealed)
+	if err != nil {
+		return nil, err
+	}
+	if got != seq {
+		return nil, &SequenceError{Expected: seq, Got: got}
+	}
+	if packet[0] == Nak {
+		return nil, &NakError{}
+	}
+	if packet[0] != request|AckFlag {
+		return nil, &CommandError{Expected: request | AckFlag, Got: packet[0]}
+	}
+	return packet[1:], nil
+}
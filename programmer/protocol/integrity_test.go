@@ -0,0 +1,67 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCRC16(t *testing.T) {
+	// The check value of CRC-16/CCITT-FALSE
+	if crc := CRC16([]byte("123456789")); crc != 0x29B1 {
+		t.Fatalf("Expected 0x29B1, got 0x%04X", crc)
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	packet := []byte{MicrowireWrite, 0x00, 0xE0, 0x00, 0x02, 0x12, 0x34}
+	sealed := Seal(packet, 7)
+
+	opened, seq, err := Open(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq != 7 || !bytes.Equal(opened, packet) {
+		t.Fatalf("Expected % X with sequence number 7, got % X with %d", packet, opened, seq)
+	}
+
+	for i := range sealed {
+		corrupt := append([]byte{}, sealed...)
+		corrupt[i] ^= 0x01
+		if _, _, err := Open(corrupt); err == nil {
+			t.Fatalf("Expected an error opening a packet with byte %d corrupted, got none", i)
+		}
+	}
+}
+
+func TestParseSealedResponse(t *testing.T) {
+	cases := []struct {
+		name     string
+		packet   []byte
+		seq      byte
+		expected []byte
+		err      error
+	}{
+		{"ack", []byte{I2CRead | AckFlag, 0xAB}, 3, []byte{0xAB}, nil},
+		{"nak", []byte{Nak}, 3, nil, &NakError{}},
+		{"wrong sequence", []byte{I2CRead | AckFlag, 0xAB}, 2, nil, &SequenceError{Expected: 3, Got: 2}},
+		{"wrong command", []byte{I2CWrite | AckFlag}, 3, nil, &CommandError{Expected: I2CRead | AckFlag, Got: I2CWrite | AckFlag}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			payload, err := ParseSealedResponse(Encode(Seal(c.packet, c.seq)), I2CRead, 3)
+			if c.err != nil {
+				if err == nil || err.Error() != c.err.Error() {
+					t.Fatalf("Expected error %v, got %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(payload, c.expected) {
+				t.Fatalf("Expected % X, got % X", c.expected, payload)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+// Package protocol implements the COBS framed serial protocol spoken by the
+// subaru immo sketch. It parses and validates every inbound packet, returning
+// typed errors rather than panicking on malformed input.
+package protocol
+
+import (
+	"fmt"
+
+	"github.com/dim13/cobs"
+)
+
+// Version is the newest version of the serial protocol supported.
+//
+// Version 1 is the original protocol, where EEPROM reads are answered with
+// the raw bytes read. From version 2 every response, reads included, is a
+// COBS packet starting with the acknowledged command byte. From version 3
+// every packet other than a reset request and its acknowledgement is sealed
+// with a sequence number and CRC, see Seal. From version 4 the sketch
+// describes itself in response to an Identify request. From version 5 I2C
+// requests carry the number of address bytes the EEPROM uses, see I2CHeader.
+// From version 6 the sketch answers I2CProbe requests. From version 7
+// Microwire requests carry the organization and address bits of the EEPROM,
+// see MicrowireHeader. From version 8 the sketch no longer write-enables
+// Microwire EEPROMs itself, and answers the MicrowireWriteEnable,
+// MicrowireErase, MicrowireEraseAll and MicrowireWriteAll requests.
+const Version = 8
+
+// Request command bytes. Each of them is acknowledged with a packet starting
+// with the same command byte, with AckFlag set.
+const (
+	Reset          byte = 0x00
+	MicrowireRead  byte = 0x01
+	MicrowireWrite byte = 0x02
+	I2CRead        byte = 0x03
+	I2CWrite       byte = 0x04
+	Identify       byte = 0x05
+	SetBaud        byte = 0x06
+	I2CProbe       byte = 0x07
+
+	MicrowireWriteEnable byte = 0x08
+	MicrowireErase       byte = 0x09
+	MicrowireEraseAll    byte = 0x0A
+	MicrowireWriteAll    byte = 0x0B
+
+	AckFlag byte = 0x80
+)
+
+// Delimiter ends every COBS frame.
+const Delimiter byte = 0x00
+
+// CommandName returns a human readable name for the request command cmd.
+func CommandName(cmd byte) string {
+	switch cmd {
+	case Reset:
+		return "reset"
+	case MicrowireRead:
+		return "microwire read"
+	case MicrowireWrite:
+		return "microwire write"
+	case I2CRead:
+		return "i2c read"
+	case I2CWrite:
+		return "i2c write"
+	case Identify:
+		return "identify"
+	case SetBaud:
+		return "set baud"
+	case I2CProbe:
+		return "i2c probe"
+	case MicrowireWriteEnable:
+		return "microwire write enable"
+	case MicrowireErase:
+		return "microwire erase"
+	case MicrowireEraseAll:
+		return "microwire erase all"
+	case MicrowireWriteAll:
+		return "microwire write all"
+	}
+	return fmt.Sprintf("0x%02X", cmd)
+}
+
+// FrameError is returned when a frame is not valid COBS.
+type FrameError struct {
+	Frame  []byte
+	Reason string
+}
+
+func (e *FrameError) Error() string {
+	return fmt.Sprintf("Malformed COBS frame. %s", e.Reason)
+}
+
+// CommandError is returned when a packet does not start with the expected
+// command byte.
+type CommandError struct {
+	Expected byte
+	Got      byte
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("Expected command %d, got %d.", e.Expected, e.Got)
+}
+
+// LengthError is returned when a packet payload is not the expected length.
+type LengthError struct {
+	Expected int
+	Got      int
+}
+
+func (e *LengthError) Error() string {
+	return fmt.Sprintf("Expected a payload of %d bytes, got %d.", e.Expected, e.Got)
+}
+
+// EmptyPacketError is returned when a frame decodes to a packet without even
+// a command byte.
+type EmptyPacketError struct{}
+
+func (e *EmptyPacketError) Error() string {
+	return "Received an empty packet."
+}
+
+// Encode returns the COBS frame for packet, including the Delimiter.
+func Encode(packet []byte) []byte {
+	return cobs.Encode(packet)
+}
+
+// Decode returns the packet held in frame, which must end with the Delimiter
+// and contain no other zero bytes.
+func Decode(frame []byte) ([]byte, error) {
+	if len(frame) == 0 || frame[len(frame)-1] != Delimiter {
+		return nil, &FrameError{Frame: frame, Reason: "The frame does not end with the 0x00 delimiter."}
+	}
+
+	data := frame[:len(frame)-1]
+	packet := make([]byte, 0, len(data))
+	for i := 0; i < len(data); {
+		code := int(data[i])
+		if code == 0 {
+			return nil, &FrameError{Frame: frame, Reason: fmt.Sprintf("Unexpected zero byte at offset %d.", i)}
+		}
+		if i+code > len(data) {
+			return nil, &FrameError{Frame: frame, Reason: fmt.Sprintf("The code byte at offset %d runs past the end of the frame.", i)}
+		}
+		for j := i + 1; j < i+code; j++ {
+			if data[j] == 0 {
+				return nil, &FrameError{Frame: frame, Reason: fmt.Sprintf("Unexpected zero byte at offset %d.", j)}
+			}
+			packet = append(packet, data[j])
+		}
+		i += code
+		if code < 0xFF && i < len(data) {
+			packet = append(packet, 0x00)
+		}
+	}
+	return packet, nil
+}
+
+// ParseResponse decodes frame, checks it acknowledges the request command, and
+// returns its payload, which follows the command byte.
+func ParseResponse(frame []byte, request byte) ([]byte, error) {
+	packet, err := Decode(frame)
+	if err != nil {
+		return nil, err
+	}
+	if len(packet) == 0 {
+		return nil, &EmptyPacketError{}
+	}
+	if packet[0] != request|AckFlag {
+		return nil, &CommandError{Expected: request | AckFlag, Got: packet[0]}
+	}
+	return packet[1:], nil
+}
+
+// IsResetAck returns true if frame is a valid acknowledgement of a reset
+// request.
+func IsResetAck(frame []byte) bool {
+	_, err := ParseResponse(frame, Reset)
+	return err == nil
+}
+
+// ParseResetAck returns the protocol version from the payload of a reset
+// acknowledgement. Sketches which predate protocol versions send no payload,
+// and speak version 1.
+func ParseResetAck(payload []byte) (int, error) {
+	if len(payload) == 0 {
+		return 1, nil
+	}
+	if len(payload) != 1 {
+		return 0, &LengthError{Expected: 1, Got: len(payload)}
+	}
+	version := int(payload[0])
+	if version < 1 || version > Version {
+		return 0, fmt.Errorf("Unsupported protocol version %d. The newest supported version is %d.", version, Version)
+	}
+	return version, nil
+}
+
+// ParseReadResponse checks the payload of a read response holds the length
+// bytes which were requested.
+func ParseReadResponse(payload []byte, length int) ([]byte, error) {
+	if len(payload) != length {
+		return nil, &LengthError{Expected: length, Got: len(payload)}
+	}
+	return payload, nil
+}
+
+// I2CHeader returns the start of an I2C read or write request for the device
+// at devAddr, up to and including the length. Before protocol version 5 the
+// sketch always sends a single address byte, so addrBytes is not included.
+func I2CHeader(cmd byte, version int, devAddr byte, addrBytes int, addr int, length int) []byte {
+	header := []byte{cmd, devAddr}
+	if version >= 5 {
+		header = append(header, byte(addrBytes))
+	}
+	return append(header, byte(addr>>8), byte(addr&0xFF), byte(length>>8), byte(length&0xFF))
+}
+
+// MicrowireHeader returns the start of a Microwire read, write or erase
+// request, up to and including the length. Erase requests end with the
+// length, and ERASE every word in it. wordBits is the organization of the EEPROM, 8
+// or 16 bits per address, and addrBits the number of address bits it expects
+// after each opcode. Before protocol version 7 the sketch only drives x16
+// EEPROMs with 8 address bits, so neither is included.
+func MicrowireHeader(cmd byte, version int, wordBits int, addrBits int, addr int, length int) []byte {
+	header := []byte{cmd}
+	if version >= 7 {
+		header = append(header, byte(wordBits), byte(addrBits))
+	}
+	return append(header, byte(addr>>8), byte(addr&0xFF), byte(length>>8), byte(length&0xFF))
+}
+
+// MicrowireWriteEnableRequest returns the request asking the sketch to send
+// the EWEN instruction to the EEPROM if enable is true, or EWDS otherwise.
+// The EEPROM ignores writes and erases while write-disabled, which it is
+// when powered up.
+func MicrowireWriteEnableRequest(wordBits int, addrBits int, enable bool) []byte {
+	flag := byte(0)
+	if enable {
+		flag = 1
+	}
+	return []byte{MicrowireWriteEnable, byte(wordBits), byte(addrBits), flag}
+}
+
+// MicrowireEraseAllRequest returns the request asking the sketch to send the
+// ERAL instruction, which sets every bit of the EEPROM to 1.
+func MicrowireEraseAllRequest(wordBits int, addrBits int) []byte {
+	return []byte{MicrowireEraseAll, byte(wordBits), byte(addrBits)}
+}
+
+// MicrowireWriteAllRequest returns the request asking the sketch to send the
+// WRAL instruction, which writes word to every address of the EEPROM. word
+// holds wordBits bits, most significant byte first.
+func MicrowireWriteAllRequest(wordBits int, addrBits int, word []byte) []byte {
+	return append([]byte{MicrowireWriteAll, byte(wordBits), byte(addrBits)}, word...)
+}
+
+// SetBaudRequest returns the request asking the sketch to switch to baud.
+// Only sketches which report more than one rate in their Identity answer it.
+// The sketch acknowledges the request at the current rate, then switches.
+func SetBaudRequest(baud int) []byte {
+	return []byte{SetBaud, byte(baud >> 24), byte(baud >> 16), byte(baud >> 8), byte(baud & 0xFF)}
+}
+
+// ParseSetBaudAck checks the payload of a set baud acknowledgement echoes the
+// requested baud rate.
+func ParseSetBaudAck(payload []byte, baud int) error {
+	if len(payload) != 4 {
+		return &LengthError{Expected: 4, Got: len(payload)}
+	}
+	if got := int(payload[0])<<24 | int(payload[1])<<16 | int(payload[2])<<8 | int(payload[3]); got != baud {
+		return fmt.Errorf("Expected the sketch to switch to %d baud, got %d.", baud, got)
+	}
+	return nil
+}
+
+// ParseI2CProbeAck returns whether the device probed by an I2CProbe request
+// acknowledged its address, which the payload holds as 1 or 0.
+func ParseI2CProbeAck(payload []byte) (bool, error) {
+	if len(payload) != 1 {
+		return false, &LengthError{Expected: 1, Got: len(payload)}
+	}
+	if payload[0] > 1 {
+		return false, fmt.Errorf("Expected an I2C probe result of 0 or 1, got %d.", payload[0])
+	}
+	return payload[0] == 1, nil
+}
+
+// ParseWriteAck checks the payload of a write acknowledgement is empty.
+func ParseWriteAck(payload []byte) error {
+	if len(payload) != 0 {
+		return &LengthError{Expected: 0, Got: len(payload)}
+	}
+	return nil
+}
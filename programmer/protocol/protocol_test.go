@@ -0,0 +1,187 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	cases := []struct {
+		name      string
+		frame     []byte
+		expected  []byte
+		expectErr bool
+	}{
+		{"reset ack", []byte{0x02, 0x80, 0x00}, []byte{0x80}, false},
+		{"zero in payload", []byte{0x01, 0x02, 0x80, 0x00}, []byte{0x00, 0x80}, false},
+		{"trailing zero in payload", []byte{0x02, 0x80, 0x01, 0x00}, []byte{0x80, 0x00}, false},
+		{"empty packet", []byte{0x00}, []byte{}, false},
+		{"no delimiter", []byte{0x02, 0x80}, nil, true},
+		{"nothing", []byte{}, nil, true},
+		{"unexpected zero code", []byte{0x00, 0x80, 0x00}, nil, true},
+		{"unexpected zero in data", []byte{0x03, 0x80, 0x00, 0x01, 0x00}, nil, true},
+		{"code past end", []byte{0x05, 0x80, 0x00}, nil, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			packet, err := Decode(c.frame)
+			if c.expectErr {
+				if _, ok := err.(*FrameError); !ok {
+					t.Fatalf("Expected a *FrameError, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(packet, c.expected) {
+				t.Fatalf("Expected % X, got % X", c.expected, packet)
+			}
+		})
+	}
+}
+
+func TestParseResponse(t *testing.T) {
+	if _, err := ParseResponse([]byte{0x00}, Reset); err == nil {
+		t.Error("Expected an error for an empty packet, got none")
+	} else if _, ok := err.(*EmptyPacketError); !ok {
+		t.Errorf("Expected an *EmptyPacketError, got %T", err)
+	}
+
+	if _, err := ParseResponse(Encode([]byte{MicrowireWrite | AckFlag}), Reset); err == nil {
+		t.Error("Expected an error for the wrong command, got none")
+	} else if _, ok := err.(*CommandError); !ok {
+		t.Errorf("Expected a *CommandError, got %T", err)
+	}
+
+	payload, err := ParseResponse(Encode([]byte{MicrowireRead | AckFlag, 0x00, 0x01}), MicrowireRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(payload, []byte{0x00, 0x01}) {
+		t.Errorf("Expected payload 00 01, got % X", payload)
+	}
+}
+
+func TestParseResetAck(t *testing.T) {
+	cases := []struct {
+		payload   []byte
+		expected  int
+		expectErr bool
+	}{
+		{nil, 1, false},
+		{[]byte{1}, 1, false},
+		{[]byte{Version}, Version, false},
+		{[]byte{0}, 0, true},
+		{[]byte{Version + 1}, 0, true},
+		{[]byte{1, 2}, 0, true},
+	}
+
+	for _, c := range cases {
+		version, err := ParseResetAck(c.payload)
+		if c.expectErr {
+			if err == nil {
+				t.Errorf("Expected an error for % X, got none", c.payload)
+			}
+			continue
+		}
+		if err != nil || version != c.expected {
+			t.Errorf("Expected version %d for % X, got %d. Error: %v", c.expected, c.payload, version, err)
+		}
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	f.Add([]byte{0x02, 0x80, 0x00})
+	f.Add([]byte{0x01, 0x02, 0x80, 0x00})
+	f.Add([]byte{0x00})
+	f.Add([]byte{0xFF, 0x01})
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, frame []byte) {
+		packet, err := Decode(frame)
+		if err != nil {
+			if _, ok := err.(*FrameError); !ok {
+				t.Fatalf("Expected a *FrameError, got %T", err)
+			}
+			return
+		}
+		if len(packet) == 0 {
+			return
+		}
+		again, err := Decode(Encode(packet))
+		if err != nil {
+			t.Fatalf("Unable to decode the encoded packet % X. Error: %s", packet, err)
+		}
+		if !bytes.Equal(again, packet) {
+			t.Fatalf("Decoded % X, but re-encoding decoded % X", packet, again)
+		}
+	})
+}
+
+func FuzzEncodeDecode(f *testing.F) {
+	f.Add([]byte{0x00})
+	f.Add([]byte{0x80, 0x02})
+	f.Add(bytes.Repeat([]byte{0x01}, 300))
+
+	f.Fuzz(func(t *testing.T, packet []byte) {
+		if len(packet) == 0 {
+			return
+		}
+		decoded, err := Decode(Encode(packet))
+		if err != nil {
+			t.Fatalf("Unable to decode the encoded packet % X. Error: %s", packet, err)
+		}
+		if !bytes.Equal(decoded, packet) {
+			t.Fatalf("Encoded % X, but decoded % X", packet, decoded)
+		}
+	})
+}
+
+func FuzzParseResponse(f *testing.F) {
+	f.Add([]byte{0x02, 0x80, 0x00}, Reset)
+	f.Add([]byte{0x03, 0x80, 0x02, 0x00}, Reset)
+	f.Add([]byte{0x02, 0x82, 0x00}, MicrowireWrite)
+	f.Add([]byte{0x00}, I2CWrite)
+	f.Add(Encode(append([]byte{Identify | AckFlag}, (&Identity{BufferSize: 64, BaudRates: []int{9600}}).Payload()...)), Identify)
+
+	f.Fuzz(func(t *testing.T, frame []byte, request byte) {
+		payload, err := ParseResponse(frame, request)
+		if err != nil {
+			return
+		}
+		// Whatever was accepted must also pass through the ack parsers
+		// without panicking
+		switch request {
+		case Reset:
+			ParseResetAck(payload)
+		case MicrowireWrite, I2CWrite, MicrowireWriteEnable, MicrowireErase, MicrowireEraseAll, MicrowireWriteAll:
+			ParseWriteAck(payload)
+		case Identify:
+			ParseIdentity(payload)
+		case SetBaud:
+			ParseSetBaudAck(payload, 115200)
+		case I2CProbe:
+			ParseI2CProbeAck(payload)
+		default:
+			ParseReadResponse(payload, len(payload))
+		}
+	})
+}
+
+func TestMicrowireHeader(t *testing.T) {
+	cases := []struct {
+		version  int
+		expected []byte
+	}{
+		{6, []byte{MicrowireRead, 0x01, 0x23, 0x00, 0x40}},
+		{7, []byte{MicrowireRead, 8, 11, 0x01, 0x23, 0x00, 0x40}},
+	}
+	for _, c := range cases {
+		header := MicrowireHeader(MicrowireRead, c.version, 8, 11, 0x123, 0x40)
+		if !bytes.Equal(header, c.expected) {
+			t.Errorf("Expected % X for version %d, got % X", c.expected, c.version, header)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package programmer
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// openPty opens a new pseudo terminal in raw mode. The slave is kept open as
+// well, so the master does not see an error each time a client closes it.
+func openPty() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to open a pseudo terminal. Error: %s", err)
+	}
+
+	var unlock int32
+	if err := ioctl(master.Fd(), syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("Unable to unlock the pseudo terminal. Error: %s", err)
+	}
+
+	var ptyNum uint32
+	if err := ioctl(master.Fd(), syscall.TIOCGPTN, unsafe.Pointer(&ptyNum)); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("Unable to find the pseudo terminal slave. Error: %s", err)
+	}
+
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", ptyNum), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("Unable to open the pseudo terminal slave. Error: %s", err)
+	}
+
+	// Raw mode, so the line discipline does not echo or translate any bytes
+	var termios syscall.Termios
+	if err := ioctl(slave.Fd(), syscall.TCGETS, unsafe.Pointer(&termios)); err == nil {
+		termios.Iflag = 0
+		termios.Oflag = 0
+		termios.Lflag = 0
+		termios.Cflag = syscall.CS8 | syscall.CREAD | syscall.CLOCAL
+		ioctl(slave.Fd(), syscall.TCSETS, unsafe.Pointer(&termios))
+	}
+
+	return master, slave, nil
+}
+
+func ioctl(fd uintptr, request uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
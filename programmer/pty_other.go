@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package programmer
+
+import (
+	"errors"
+	"os"
+)
+
+func openPty() (*os.File, *os.File, error) {
+	return nil, nil, errors.New("Emulating an Arduino on a pseudo terminal is only supported on Linux")
+}
@@ -0,0 +1,491 @@
+package programmer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rgeyer/93l56r-cli/programmer/protocol"
+)
+
+// simulatedPortPrefix is the --serial-port prefix which selects the in process
+// EEPROM simulator rather than a real serial port. I.E. sim://path/to/image.bin
+//
+// The path may be followed by options for the simulator, I.E.
+// sim://path/to/image.bin?protocol=1 simulates a sketch which only supports
+// protocol version 1. The options are
+//
+//	protocol  the newest protocol version supported
+//	buffer    the serial buffer size, 64 by default
+//	bus       a bus which is supported, microwire or i2c. May be repeated,
+//	          all are supported by default
+//	baud      a baud rate which is supported. May be repeated, the common
+//	          rates from 9600 to 115200 are supported by default
+//	cable     the fastest baud rate the simulated cable can carry
+//	i2c       the address of another device on the I2C bus, besides the
+//	          EEPROM, which answers at 0x50 to 0x57 like a 24C16. May be
+//	          repeated
+const simulatedPortPrefix = "sim://"
+
+// simulatedSerial stands in for the serial connection to an Arduino running
+// the subaru immo sketch. It speaks the same COBS framed command set, and
+// keeps the EEPROM contents in a memory image which is persisted to a file.
+//
+// Like the sketch, reset and write requests are acknowledged with a COBS
+// packet, while EEPROM reads are answered with the raw (unframed) bytes when
+// using protocol version 1, or with a COBS packet from version 2. From
+// version 3 requests and responses are sealed with a sequence number and CRC,
+// and corrupted requests are answered with a NAK.
+type simulatedSerial struct {
+	imagePath   string
+	image       []byte
+	maxProtocol int
+	protocol    int
+	seq         byte
+	identity    protocol.Identity
+	pending     []byte
+	responses   bytes.Buffer
+	i2cDevices  []byte
+
+	// microwireWriteEnabled is whether the Microwire EEPROM accepts writes.
+	// Like the EEPROM it is write-disabled when powered up, and from
+	// protocol version 8 only the MicrowireWriteEnable request changes it.
+	microwireWriteEnabled bool
+
+	// baud is the rate the sketch is running at, hostBaud the rate the port
+	// was opened at, which is zero when the line is not simulated. Anything
+	// sent at a different rate, or faster than the cableBaud, is garbled.
+	baud      int
+	hostBaud  int
+	cableBaud int
+}
+
+// newSimulatedSerial returns a simulator for spec, which is the path to the
+// EEPROM image, optionally followed by options. I.E. image.bin?protocol=1
+func newSimulatedSerial(spec string) (*simulatedSerial, error) {
+	imagePath, options := spec, ""
+	if idx := strings.Index(spec, "?"); idx >= 0 {
+		imagePath, options = spec[:idx], spec[idx+1:]
+	}
+
+	s := &simulatedSerial{
+		imagePath:   imagePath,
+		maxProtocol: ProtocolVersion,
+		protocol:    1,
+		identity: protocol.Identity{
+			FirmwareMajor: 1,
+			BufferSize:    defaultBufferSize,
+			Buses:         protocol.BusMicrowire | protocol.BusI2C,
+			BaudRates:     []int{DefaultBaudRate, 19200, 38400, 57600, 115200},
+		},
+		baud: DefaultBaudRate,
+	}
+
+	values, err := url.ParseQuery(options)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse the simulator options %q. Error: %s", options, err)
+	}
+	if v := values.Get("protocol"); v != "" {
+		if s.maxProtocol, err = strconv.Atoi(v); err != nil || s.maxProtocol < 1 || s.maxProtocol > ProtocolVersion {
+			return nil, fmt.Errorf("The simulator protocol must be between 1 and %d, got %s", ProtocolVersion, v)
+		}
+	}
+	if v := values.Get("buffer"); v != "" {
+		if s.identity.BufferSize, err = strconv.Atoi(v); err != nil || s.identity.BufferSize < 16 || s.identity.BufferSize > 0xFFFF {
+			return nil, fmt.Errorf("The simulator buffer must be between 16 and 65535 bytes, got %s", v)
+		}
+	}
+	if buses, ok := values["bus"]; ok {
+		s.identity.Buses = 0
+		for _, bus := range buses {
+			switch IcType(bus) {
+			case Microwire:
+				s.identity.Buses |= protocol.BusMicrowire
+			case I2C:
+				s.identity.Buses |= protocol.BusI2C
+			default:
+				return nil, fmt.Errorf("The simulator bus must be one of: microwire, i2c, got %s", bus)
+			}
+		}
+	}
+
+	if bauds, ok := values["baud"]; ok {
+		s.identity.BaudRates = nil
+		for _, v := range bauds {
+			baud, err := strconv.Atoi(v)
+			if err != nil || baud <= 0 {
+				return nil, fmt.Errorf("The simulator baud must be a positive number, got %s", v)
+			}
+			s.identity.BaudRates = append(s.identity.BaudRates, baud)
+		}
+	}
+	if v := values.Get("cable"); v != "" {
+		if s.cableBaud, err = strconv.Atoi(v); err != nil || s.cableBaud < DefaultBaudRate {
+			return nil, fmt.Errorf("The simulator cable must carry at least %d baud, got %s", DefaultBaudRate, v)
+		}
+	}
+
+	for _, v := range values["i2c"] {
+		devAddr, err := strconv.ParseUint(v, 0, 7)
+		if err != nil {
+			return nil, fmt.Errorf("The simulator i2c device address must be between 0x00 and 0x7F, got %s", v)
+		}
+		s.i2cDevices = append(s.i2cDevices, byte(devAddr))
+	}
+
+	s.image, err = ioutil.ReadFile(imagePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("Unable to load simulated EEPROM image %s. Error: %s", imagePath, err)
+	}
+
+	return s, nil
+}
+
+// Read returns whatever responses are queued. When there are none it behaves
+// like a serial port which reached its read timeout, and returns io.EOF.
+func (s *simulatedSerial) Read(p []byte) (int, error) {
+	if s.responses.Len() == 0 {
+		return 0, io.EOF
+	}
+	return s.responses.Read(p)
+}
+
+// Write accepts any number of bytes, and processes each complete COBS packet
+// (terminated by 0x00) as it arrives.
+func (s *simulatedSerial) Write(p []byte) (int, error) {
+	if s.hostBaud != 0 && (s.hostBaud != s.baud || (s.cableBaud != 0 && s.hostBaud > s.cableBaud)) {
+		// Like the sketch, give up on a rate nothing can be understood at
+		s.baud = DefaultBaudRate
+		s.pending = nil
+		return len(p), nil
+	}
+
+	s.pending = append(s.pending, p...)
+	for {
+		idx := bytes.IndexByte(s.pending, 0x00)
+		if idx < 0 {
+			break
+		}
+		frame := s.pending[:idx+1]
+		s.pending = s.pending[idx+1:]
+		if len(frame) > s.identity.BufferSize {
+			// The sketch would have overflowed its serial buffer
+			continue
+		}
+		packet, err := protocol.Decode(frame)
+		if err != nil {
+			// Like the sketch, ignore anything which is not a valid packet
+			continue
+		}
+		// The reset request is never sealed, since it is how the protocol
+		// version is negotiated
+		if s.protocol >= 3 && !(len(packet) <= 2 && packet[0] == protocol.Reset) {
+			opened, seq, err := protocol.Open(packet)
+			if err != nil {
+				if len(packet) > 1 {
+					seq = packet[1]
+				}
+				s.responses.Write(protocol.Encode(protocol.Seal([]byte{protocol.Nak}, seq)))
+				continue
+			}
+			packet, s.seq = opened, seq
+		}
+		if err := s.handle(packet); err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+func (s *simulatedSerial) Close() error {
+	return nil
+}
+
+// open simulates the port being opened at baud. Unlike opening the port of
+// an Arduino, it does not reset the sketch.
+func (s *simulatedSerial) open(baud int) {
+	s.hostBaud = baud
+	s.responses.Reset()
+}
+
+// Reset forgets any partially received request, and any response which has
+// not been read yet, like the sketch does when the Arduino resets.
+func (s *simulatedSerial) Reset() {
+	s.pending = nil
+	s.responses.Reset()
+}
+
+func (s *simulatedSerial) handle(packet []byte) error {
+	if len(packet) == 0 {
+		return nil
+	}
+
+	switch packet[0] {
+	case protocol.Reset:
+		s.Reset()
+		// Sketches which predate protocol versions ignore the offered version
+		s.protocol = 1
+		if len(packet) < 2 || s.maxProtocol < 2 {
+			s.ack(protocol.Reset)
+			return nil
+		}
+		s.protocol = int(packet[1])
+		if s.protocol > s.maxProtocol {
+			s.protocol = s.maxProtocol
+		}
+		s.ack(protocol.Reset, byte(s.protocol))
+	case protocol.Identify:
+		if s.protocol < 4 {
+			return nil
+		}
+		s.ack(protocol.Identify, s.identity.Payload()...)
+	case protocol.SetBaud:
+		if len(packet) < 5 || len(s.identity.BaudRates) < 2 {
+			return nil
+		}
+		baud := readUint16(packet[1:])<<16 | readUint16(packet[3:])
+		for _, b := range s.identity.BaudRates {
+			if b == baud {
+				s.ack(protocol.SetBaud, packet[1:5]...)
+				s.baud = baud
+			}
+		}
+	case protocol.I2CProbe:
+		if len(packet) < 2 || s.protocol < 6 {
+			return nil
+		}
+		present := byte(0)
+		if isSimulatedEEPROM(packet[1]) || bytes.IndexByte(s.i2cDevices, packet[1]) >= 0 {
+			present = 1
+		}
+		s.ack(protocol.I2CProbe, present)
+	case protocol.MicrowireRead:
+		offset, rest, ok := s.microwireRequest(packet)
+		if !ok {
+			return nil
+		}
+		s.respond(protocol.MicrowireRead, s.read(offset, readUint16(rest)))
+	case protocol.MicrowireWrite:
+		offset, rest, ok := s.microwireRequest(packet)
+		if !ok {
+			return nil
+		}
+		if s.microwireWritable() {
+			if err := s.write(offset, rest[2:]); err != nil {
+				return err
+			}
+		}
+		s.ack(protocol.MicrowireWrite)
+	case protocol.MicrowireWriteEnable:
+		if len(packet) < 4 || s.protocol < 8 {
+			return nil
+		}
+		s.microwireWriteEnabled = packet[3] == 1
+		s.ack(protocol.MicrowireWriteEnable)
+	case protocol.MicrowireErase:
+		if s.protocol < 8 {
+			return nil
+		}
+		offset, rest, ok := s.microwireRequest(packet)
+		if !ok {
+			return nil
+		}
+		if s.microwireWritable() {
+			if err := s.write(offset, bytes.Repeat([]byte{0xFF}, readUint16(rest))); err != nil {
+				return err
+			}
+		}
+		s.ack(protocol.MicrowireErase)
+	case protocol.MicrowireEraseAll, protocol.MicrowireWriteAll:
+		if len(packet) < 3 || s.protocol < 8 {
+			return nil
+		}
+		wordBits, addrBits := int(packet[1]), int(packet[2])
+		if !isMicrowireGeometry(wordBits, addrBits) {
+			s.nak()
+			return nil
+		}
+		word := bytes.Repeat([]byte{0xFF}, wordBits/8)
+		if packet[0] == protocol.MicrowireWriteAll {
+			word = packet[3:]
+		}
+		if len(word) != wordBits/8 {
+			s.nak()
+			return nil
+		}
+		if s.microwireWritable() {
+			if err := s.write(0, bytes.Repeat(word, s.microwireWords(wordBits, addrBits))); err != nil {
+				return err
+			}
+		}
+		s.ack(packet[0])
+	case protocol.I2CRead:
+		addr, rest, ok := s.i2cRequest(packet)
+		if !ok {
+			return nil
+		}
+		s.respond(protocol.I2CRead, s.read(addr, readUint16(rest)))
+	case protocol.I2CWrite:
+		addr, rest, ok := s.i2cRequest(packet)
+		if !ok {
+			return nil
+		}
+		if err := s.write(addr, rest[2:]); err != nil {
+			return err
+		}
+		s.ack(protocol.I2CWrite)
+	}
+	return nil
+}
+
+// isSimulatedEEPROM returns true if the simulated I2C EEPROM answers at
+// devAddr.
+func isSimulatedEEPROM(devAddr byte) bool {
+	return devAddr&^0x07 == DefaultI2CAddress
+}
+
+// i2cRequest returns the address of an I2C read or write request, and the
+// rest of it, starting with the length. Like the sketch, only the low address
+// byte is sent to EEPROMs with a single address byte, and the simulated
+// EEPROM takes the block from the low bits of the device address, like a
+// 24C16. Requests for other devices are not answered.
+func (s *simulatedSerial) i2cRequest(packet []byte) (int, []byte, bool) {
+	if len(packet) < 2 || !isSimulatedEEPROM(packet[1]) {
+		return 0, nil, false
+	}
+	addrBytes := 1
+	rest := packet[2:]
+	if s.protocol >= 5 {
+		if len(packet) < 3 {
+			return 0, nil, false
+		}
+		addrBytes = int(packet[2])
+		rest = packet[3:]
+	}
+	if len(rest) < 4 {
+		return 0, nil, false
+	}
+
+	addr := readUint16(rest)
+	if addrBytes == 1 {
+		addr = int(packet[1]&0x07)<<8 | addr&0xFF
+	}
+	return addr, rest[2:], true
+}
+
+// microwireWords returns how many words ERAL and WRAL set. The simulated
+// EEPROM is the size of its image, or a 93L56R while the image is empty, so
+// the image does not grow past it.
+func (s *simulatedSerial) microwireWords(wordBits, addrBits int) int {
+	size := len(s.image)
+	if size == 0 {
+		size = Chips["93L56R"].Size
+	}
+	words := size / (wordBits / 8)
+	if limit := 1 << uint(addrBits); words > limit {
+		words = limit
+	}
+	return words
+}
+
+// microwireRequest returns the image offset addressed by a Microwire read or
+// write request, and the rest of the request after the address. Like the
+// EEPROM it ignores requests with an address beyond its address bits. Before
+// protocol version 7 the EEPROM is organized as x16 with 8 address bits.
+func (s *simulatedSerial) microwireRequest(packet []byte) (int, []byte, bool) {
+	wordBits, addrBits := DefaultMicrowireOrganization, DefaultMicrowireAddressBits
+	rest := packet[1:]
+	if s.protocol >= 7 {
+		if len(packet) < 3 {
+			return 0, nil, false
+		}
+		wordBits, addrBits = int(packet[1]), int(packet[2])
+		rest = packet[3:]
+	}
+	if len(rest) < 4 || !isMicrowireGeometry(wordBits, addrBits) {
+		return 0, nil, false
+	}
+
+	addr := readUint16(rest)
+	if addr >= 1<<uint(addrBits) {
+		return 0, nil, false
+	}
+	return addr * wordBits / 8, rest[2:], true
+}
+
+// isMicrowireGeometry returns true if an EEPROM organized as wordBits with
+// addrBits address bits is one of the 93C46 to 93C86.
+func isMicrowireGeometry(wordBits int, addrBits int) bool {
+	return (wordBits == 8 || wordBits == 16) && addrBits >= minMicrowireAddressBits && addrBits <= maxMicrowireAddressBits
+}
+
+// nak answers a request the sketch can not carry out with a NAK, like one
+// which arrived corrupted.
+func (s *simulatedSerial) nak() {
+	if s.protocol < 3 {
+		return
+	}
+	s.responses.Write(protocol.Encode(protocol.Seal([]byte{protocol.Nak}, s.seq)))
+}
+
+// microwireWritable returns true if the Microwire EEPROM accepts writes.
+// Before protocol version 8 the sketch write-enables it for every write.
+func (s *simulatedSerial) microwireWritable() bool {
+	return s.protocol < 8 || s.microwireWriteEnabled
+}
+
+// ack acknowledges the request cmd with a packet holding payload, sealed with
+// the sequence number of the request from protocol version 3.
+func (s *simulatedSerial) ack(cmd byte, payload ...byte) {
+	packet := append([]byte{cmd | protocol.AckFlag}, payload...)
+	if s.protocol >= 3 && cmd != protocol.Reset {
+		packet = protocol.Seal(packet, s.seq)
+	}
+	s.responses.Write(protocol.Encode(packet))
+}
+
+// respond answers the read request cmd with data, which is only framed from
+// protocol version 2.
+func (s *simulatedSerial) respond(cmd byte, data []byte) {
+	if s.protocol < 2 {
+		s.responses.Write(data)
+		return
+	}
+	s.ack(cmd, data...)
+}
+
+// read returns length bytes of the image starting at offset. Anything past the
+// end of the image reads as 0xFF, just like an erased EEPROM.
+func (s *simulatedSerial) read(offset int, length int) []byte {
+	buf := make([]byte, length)
+	for i := range buf {
+		buf[i] = 0xFF
+	}
+	if offset < len(s.image) {
+		copy(buf, s.image[offset:])
+	}
+	return buf
+}
+
+// write stores buf in the image at offset, growing the image if needed, and
+// saves the image to disk.
+func (s *simulatedSerial) write(offset int, buf []byte) error {
+	for len(s.image) < offset+len(buf) {
+		s.image = append(s.image, 0xFF)
+	}
+	copy(s.image[offset:], buf)
+
+	if err := ioutil.WriteFile(s.imagePath, s.image, 0644); err != nil {
+		return fmt.Errorf("Unable to save simulated EEPROM image %s. Error: %s", s.imagePath, err)
+	}
+	return nil
+}
+
+func readUint16(b []byte) int {
+	return int(b[0])<<8 | int(b[1])
+}
@@ -0,0 +1,77 @@
+package programmer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/rgeyer/93l56r-cli/programmer/protocol"
+)
+
+// simulatorExchange sends packet to the simulator, and returns the payload of
+// its response to cmd.
+func simulatorExchange(t *testing.T, s *simulatedSerial, cmd byte, packet []byte) []byte {
+	t.Helper()
+	if _, err := s.Write(protocol.Encode(packet)); err != nil {
+		t.Fatal(err)
+	}
+	frame, _ := ioutil.ReadAll(s)
+	payload, err := protocol.ParseResponse(frame, cmd)
+	if err != nil {
+		t.Fatalf("Unable to parse the response % X to the %s request. Error: %s", frame, protocol.CommandName(cmd), err)
+	}
+	return payload
+}
+
+func TestSimulatorRoundTrip(t *testing.T) {
+	image := filepath.Join(t.TempDir(), "image.bin")
+	s, err := newSimulatedSerial(image + "?protocol=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version, err := protocol.ParseResetAck(simulatorExchange(t, s, protocol.Reset, []byte{protocol.Reset, 2})); err != nil || version != 2 {
+		t.Fatalf("Expected the reset to be acknowledged with version 2, got %d. Error: %v", version, err)
+	}
+
+	microwire := []byte{0x93, 0x56, 0xAB, 0xCD}
+	ack := simulatorExchange(t, s, protocol.MicrowireWrite, append([]byte{protocol.MicrowireWrite, 0x00, 0x10, 0x00, 0x04}, microwire...))
+	if err := protocol.ParseWriteAck(ack); err != nil {
+		t.Fatal(err)
+	}
+	if read := simulatorExchange(t, s, protocol.MicrowireRead, []byte{protocol.MicrowireRead, 0x00, 0x10, 0x00, 0x04}); !bytes.Equal(read, microwire) {
+		t.Fatalf("Expected % X, got % X", microwire, read)
+	}
+
+	i2c := []byte{0x24, 0xC0}
+	ack = simulatorExchange(t, s, protocol.I2CWrite, append([]byte{protocol.I2CWrite, DefaultI2CAddress, 0x00, 0x40, 0x00, 0x02}, i2c...))
+	if err := protocol.ParseWriteAck(ack); err != nil {
+		t.Fatal(err)
+	}
+	if read := simulatorExchange(t, s, protocol.I2CRead, []byte{protocol.I2CRead, DefaultI2CAddress, 0x00, 0x40, 0x00, 0x02}); !bytes.Equal(read, i2c) {
+		t.Fatalf("Expected % X, got % X", i2c, read)
+	}
+
+	// Both writes are persisted, with anything never written erased
+	saved, err := ioutil.ReadFile(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := bytes.Repeat([]byte{0xFF}, 0x42)
+	copy(expected[0x20:], microwire)
+	copy(expected[0x40:], i2c)
+	if !bytes.Equal(saved, expected) {
+		t.Fatalf("Expected the image\n% X\ngot\n% X", expected, saved)
+	}
+
+	// A new simulator picks up the persisted image
+	again, err := newSimulatedSerial(image + "?protocol=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	simulatorExchange(t, again, protocol.Reset, []byte{protocol.Reset, 2})
+	if read := simulatorExchange(t, again, protocol.MicrowireRead, []byte{protocol.MicrowireRead, 0x00, 0x10, 0x00, 0x04}); !bytes.Equal(read, microwire) {
+		t.Fatalf("Expected % X from the persisted image, got % X", microwire, read)
+	}
+}
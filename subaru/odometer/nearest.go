@@ -0,0 +1,113 @@
+package odometer
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// Confidence describes how likely it is that the mileage found by
+// DecodeNearest is the one which was actually stored.
+type Confidence int
+
+const (
+	// ConfidenceLow means several mileages are equally close to the block.
+	ConfidenceLow Confidence = iota
+	// ConfidenceMedium means one mileage is closest, but the next best is only
+	// one bit further away.
+	ConfidenceMedium
+	// ConfidenceHigh means one mileage is closest, and the next best is at
+	// least two bits further away.
+	ConfidenceHigh
+	// ConfidenceExact means the block is a valid encoding of the mileage.
+	ConfidenceExact
+)
+
+func (c Confidence) String() string {
+	switch c {
+	case ConfidenceLow:
+		return "low"
+	case ConfidenceMedium:
+		return "medium"
+	case ConfidenceHigh:
+		return "high"
+	case ConfidenceExact:
+		return "exact"
+	}
+	return fmt.Sprintf("Confidence(%d)", int(c))
+}
+
+// Match is a mileage whose encoded block is close to a damaged block.
+type Match struct {
+	Mileage int
+	// Distance is the number of bits which differ between the block and the
+	// encoded mileage.
+	Distance int
+}
+
+// Recovery is the result of DecodeNearest.
+type Recovery struct {
+	// Matches are all of the mileages at the smallest distance from the block,
+	// lowest mileage first.
+	Matches    []Match
+	Confidence Confidence
+	// Margin is how many more bits differ for the next best mileage.
+	Margin int
+}
+
+// DecodeNearest finds the mileage between 0 and maxMileage whose encoded
+// block is closest to encoded_buffer, counting the bits which differ. It is
+// meant for blocks which Decode rejects because a few bits have flipped.
+// encoded_buffer is not modified.
+//
+// maxMileage is normally MaxMileage, or MaxFullRangeMileage to consider the
+// full 20bit range.
+func DecodeNearest(encoded_buffer []byte, maxMileage int) (*Recovery, error) {
+	if len(encoded_buffer) != BlockSize {
+		return nil, corrupt("Expected %d bytes, got %d", BlockSize, len(encoded_buffer))
+	}
+	if maxMileage < 0 || maxMileage > MaxFullRangeMileage {
+		return nil, fmt.Errorf("The maximum mileage must be between 0 and %d, got %d", MaxFullRangeMileage, maxMileage)
+	}
+
+	best := BlockSize*8 + 1
+	secondBest := best
+	var matches []Match
+
+	candidate := make([]byte, BlockSize)
+	for mileage := 0; mileage <= maxMileage; mileage++ {
+		encodeInto(candidate, mileage)
+
+		distance := 0
+		for i := range candidate {
+			distance += bits.OnesCount8(candidate[i] ^ encoded_buffer[i])
+		}
+
+		switch {
+		case distance < best:
+			secondBest = best
+			best = distance
+			matches = []Match{{Mileage: mileage, Distance: distance}}
+		case distance == best:
+			matches = append(matches, Match{Mileage: mileage, Distance: distance})
+		case distance < secondBest:
+			secondBest = distance
+		}
+	}
+
+	recovery := &Recovery{Matches: matches}
+	if len(matches) > 1 {
+		recovery.Confidence = ConfidenceLow
+		return recovery, nil
+	}
+
+	recovery.Margin = secondBest - best
+	switch {
+	case best == 0:
+		recovery.Confidence = ConfidenceExact
+	case recovery.Margin >= 2:
+		recovery.Confidence = ConfidenceHigh
+	default:
+		recovery.Confidence = ConfidenceMedium
+	}
+	return recovery, nil
+}
@@ -0,0 +1,65 @@
+package odometer
+
+import "testing"
+
+func TestDecodeNearest(t *testing.T) {
+	cases := []struct {
+		name       string
+		mileage    int
+		flipBits   []int
+		matches    []int
+		confidence Confidence
+		margin     int
+	}{
+		{"valid block", 157889, nil, []int{157889}, ConfidenceExact, 3},
+		{"one flipped bit", 157889, []int{37}, []int{157889}, ConfidenceHigh, 3},
+		{"one flipped bit at zero", 0, []int{3}, []int{0}, ConfidenceHigh, 15},
+		{"one flipped bit at max", MaxMileage, []int{200}, []int{MaxMileage}, ConfidenceHigh, 3},
+		// 157890 encodes 3 bits away from 157889, one of them is bit 40
+		{"one flipped bit towards the next mileage", 157889, []int{40}, []int{157889}, ConfidenceMedium, 1},
+		// 157952 encodes 4 bits away from 157951, two of them are bits 9 and 10
+		{"halfway between two mileages", 157951, []int{9, 10}, []int{157951, 157952}, ConfidenceLow, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			buf, _ := Encode(c.mileage)
+			for _, bit := range c.flipBits {
+				buf[bit/8] ^= 1 << uint(bit%8)
+			}
+
+			recovery, err := DecodeNearest(buf, MaxMileage)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(recovery.Matches) != len(c.matches) {
+				t.Fatalf("Expected the matches %v, got %v", c.matches, recovery.Matches)
+			}
+			for i, m := range recovery.Matches {
+				if m.Mileage != c.matches[i] {
+					t.Fatalf("Expected the matches %v, got %v", c.matches, recovery.Matches)
+				}
+				if m.Distance != len(c.flipBits) {
+					t.Fatalf("Expected a distance of %d, got %d", len(c.flipBits), m.Distance)
+				}
+			}
+			if recovery.Confidence != c.confidence {
+				t.Fatalf("Expected %s confidence, got %s", c.confidence, recovery.Confidence)
+			}
+			if recovery.Margin != c.margin {
+				t.Fatalf("Expected a margin of %d, got %d", c.margin, recovery.Margin)
+			}
+		})
+	}
+}
+
+func TestDecodeNearestErrors(t *testing.T) {
+	buf, _ := Encode(116)
+
+	if _, err := DecodeNearest(buf[:BlockSize-1], MaxMileage); err == nil {
+		t.Error("Expected an error for a short block, got none")
+	}
+	if _, err := DecodeNearest(buf, MaxFullRangeMileage+1); err == nil {
+		t.Error("Expected an error for a maximum mileage past the 20bit range, got none")
+	}
+}
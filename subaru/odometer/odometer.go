@@ -1,20 +1,105 @@
 package odometer
 
-import "bytes"
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// BlockSize is the length, in bytes, of an encoded odometer value.
+const BlockSize = 0x20
+
+// MaxMileage is the largest mileage the six digit odometer can display.
+const MaxMileage = 999999
+
+// MaxFullRangeMileage is the largest mileage which fits in the 20bit odometer.
+const MaxFullRangeMileage = 0xFFFFF
+
+// EEPROMSize is the size, in bytes, of the right-vertical 93L56R of the
+// combination meter.
+const EEPROMSize = 256
+
+// Addresses are the 16bit word addresses of the two copies of the odometer
+// in the right-vertical 93L56R of the combination meter, which holds 128 words
+// (0x00 to 0x7F). The meter sends them as 0xE0 and 0xF0, but the 93L56R
+// ignores the top of its 8 address bits, so they are the words 0x60 and 0x70.
+// Each copy is BlockSize bytes, at the byte offsets 0xC0 and 0xE0 of a 256
+// byte dump of the EEPROM.
+var Addresses = [...]int{0x60, 0x70}
+
+// ImageBlocks returns both copies of the odometer from a dump of the
+// right-vertical EEPROM, in the order of Addresses. The blocks share their
+// memory with image, so changing them changes the image.
+func ImageBlocks(image []byte) ([][]byte, error) {
+	var blocks [][]byte
+	for _, addr := range Addresses {
+		offset := addr * 2
+		if offset+BlockSize > len(image) {
+			return nil, fmt.Errorf("The EEPROM dump is %d bytes long, which is too short to contain the odometer copy at 0x%X", len(image), addr)
+		}
+		blocks = append(blocks, image[offset:offset+BlockSize])
+	}
+	return blocks, nil
+}
+
+// PatchImage sets both copies of the odometer in a dump of the right-vertical
+// EEPROM to mileage, which must be between 0 and MaxMileage. The rest of the
+// dump is left untouched.
+func PatchImage(image []byte, mileage int) error {
+	buf, err := Encode(mileage)
+	if err != nil {
+		return err
+	}
+	blocks, err := ImageBlocks(image)
+	if err != nil {
+		return err
+	}
+	for _, block := range blocks {
+		copy(block, buf)
+	}
+	return nil
+}
 
 var encode_table = [...]byte{0x00, 0x07, 0x0C, 0x0B, 0x06, 0x01, 0x0A, 0x0D, 0x03, 0x04, 0x0F, 0x08, 0x05, 0x02, 0x09, 0x0E}
 
-func Encode(mileage int) []byte {
+// Encode returns the BlockSize block which stores mileage, which must be
+// between 0 and MaxMileage.
+//
+// The block holds a new value (mileage / 16) and an old value (new value - 1),
+// with the lowest nibble of the mileage deciding how many slots hold the new
+// value. At a mileage of 0 the old value is -1, which is stored as 0xFFFE
+// once encoded, and which Decode accepts as one less than 0.
+func Encode(mileage int) ([]byte, error) {
+	if mileage < 0 || mileage > MaxMileage {
+		return nil, fmt.Errorf("The mileage must be between 0 and %d, got %d", MaxMileage, mileage)
+	}
+	return encode(mileage), nil
+}
+
+// EncodeFullRange is the same as Encode, but accepts the full 20bit range of
+// the odometer, up to MaxFullRangeMileage. It is not known how the
+// combination meter displays values larger than MaxMileage.
+func EncodeFullRange(mileage int) ([]byte, error) {
+	if mileage < 0 || mileage > MaxFullRangeMileage {
+		return nil, fmt.Errorf("The mileage must be between 0 and %d, got %d", MaxFullRangeMileage, mileage)
+	}
+	return encode(mileage), nil
+}
+
+func encode(mileage int) []byte {
+	data_buffer := make([]byte, BlockSize)
+	encodeInto(data_buffer, mileage)
+	return data_buffer
+}
+
+// encodeInto encodes mileage into data_buffer, which must be BlockSize bytes.
+func encodeInto(data_buffer []byte, mileage int) {
 	repeat_count := mileage & 0x0F // Take lowest nibble and use it as the repeat count
 	new_value := mileage >> 4      // The new count has that lowest nibble shaved off
 	old_value := new_value - 1     // The old count will be new count - 1
 
-	data_buffer := make([]byte, 0x20) // use this as a workspace
-
-	encode_table := []byte{0x00, 0x07, 0x0C, 0x0B, 0x06, 0x01, 0x0A, 0x0D, 0x03, 0x04, 0x0F, 0x08, 0x05, 0x02, 0x09, 0x0E}
 	// Encoding table for the least significant 4 bits..
 	// as each value changes, 3 bits change and 1 stays the same. This is probably some wear leveling scheme for the EEPROM
-
 	new_value = (new_value & 0xFFF0) + int(encode_table[new_value&0x0F]) // do encodings on both values
 	old_value = (old_value & 0xFFF0) + int(encode_table[old_value&0x0F])
 
@@ -35,38 +120,89 @@ func Encode(mileage int) []byte {
 		data_buffer[2+count*4] ^= 0xFF
 		data_buffer[3+count*4] ^= 0xFF
 	}
+}
 
-	return data_buffer
+// ErrBlank is returned by Decode when the block is erased (all 0xFF) or
+// cleared (all 0x00), and therefore holds no odometer value at all.
+var ErrBlank = errors.New("The odometer block is blank")
+
+// CorruptBlockError is returned by Decode when the block does not have the
+// structure written by Encode.
+type CorruptBlockError struct {
+	Reason string
+}
+
+func (e *CorruptBlockError) Error() string {
+	return fmt.Sprintf("The odometer block is corrupt. %s", e.Reason)
 }
 
-func Decode(encoded_buffer []byte) int {
-	// Commence (de)coding
-	for count := 0; count < 8; count++ {
-		encoded_buffer[2+count*4] ^= 0xFF
-		encoded_buffer[3+count*4] ^= 0xFF
+func corrupt(format string, a ...interface{}) error {
+	return &CorruptBlockError{Reason: fmt.Sprintf(format, a...)}
+}
+
+// Decode returns the mileage stored in encoded_buffer, which must be a
+// BlockSize block created by Encode. encoded_buffer is not modified.
+//
+// The block is validated while decoding. Every slot must hold either the new
+// value or the old value, with the new value only in the leading slots, the
+// old value must be one less than the new value. An ErrBlank or
+// *CorruptBlockError is returned if it does not. The encoding table maps every
+// low nibble to another, so any low nibble decodes.
+func Decode(encoded_buffer []byte) (int, error) {
+	if len(encoded_buffer) != BlockSize {
+		return 0, corrupt("Expected %d bytes, got %d", BlockSize, len(encoded_buffer))
+	}
+	if isFilled(encoded_buffer, 0xFF) || isFilled(encoded_buffer, 0x00) {
+		return 0, ErrBlank
 	}
 
-	// Count the number of times the two byte pair occurs
-	repeat_count := 0
-	new_value := int(encoded_buffer[0]) << 8
-	new_value = new_value | int(encoded_buffer[1]&0xFF)
-	old_value := new_value
+	// Commence (de)coding, every other slot is inverted
+	slots := make([]int, 16)
 	for count := 0; count < 16; count++ {
-		new_value = int(encoded_buffer[count*2]) << 8
-		new_value = new_value | int(encoded_buffer[count*2+1]&0xFF)
-
-		if new_value != old_value {
-			break
+		slots[count] = int(encoded_buffer[count*2])<<8 | int(encoded_buffer[count*2+1])
+		if count%2 == 1 {
+			slots[count] ^= 0xFFFF
 		}
+	}
 
-		old_value = new_value
+	// Count the number of times the new value occurs
+	new_value := slots[0]
+	repeat_count := 0
+	for repeat_count < 16 && slots[repeat_count] == new_value {
 		repeat_count++
 	}
 
-	// (de)Code the last nibble
-	last_nibble := old_value & 0x000F
-	old_value = (old_value & 0xFFF0) + int(bytes.IndexByte(encode_table[:], byte(last_nibble)))
-	final_value := (old_value << 4) + repeat_count - 1
+	// The remaining slots must all hold the old value
+	for count := repeat_count + 1; count < 16; count++ {
+		if slots[count] != slots[repeat_count] {
+			return 0, corrupt("Slot %d holds 0x%04X, expected the new value 0x%04X or the old value 0x%04X", count, slots[count], new_value, slots[repeat_count])
+		}
+	}
+
+	new_decoded := decodeValue(new_value)
+	if repeat_count < 16 {
+		old_decoded := decodeValue(slots[repeat_count])
+		// The old value wraps to 0xFFFF when the new value is 0
+		if old_decoded != (new_decoded-1)&0xFFFF {
+			return 0, corrupt("The old value 0x%04X is not one less than the new value 0x%04X", old_decoded, new_decoded)
+		}
+	}
+
+	return (new_decoded << 4) + repeat_count - 1, nil
+}
+
+// decodeValue reverses the encoding of the last nibble of a slot value. The
+// encoding table holds every nibble exactly once, so each has a decoding.
+func decodeValue(value int) int {
+	last_nibble := bytes.IndexByte(encode_table[:], byte(value&0x000F))
+	return (value & 0xFFF0) + last_nibble
+}
 
-	return final_value
+func isFilled(buf []byte, b byte) bool {
+	for _, v := range buf {
+		if v != b {
+			return false
+		}
+	}
+	return true
 }
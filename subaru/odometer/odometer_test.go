@@ -0,0 +1,217 @@
+package odometer
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeRange(t *testing.T) {
+	cases := []struct {
+		name      string
+		encode    func(int) ([]byte, error)
+		mileage   int
+		expectErr bool
+	}{
+		{"zero", Encode, 0, false},
+		{"max", Encode, MaxMileage, false},
+		{"negative", Encode, -1, true},
+		{"past max", Encode, MaxMileage + 1, true},
+		{"full range zero", EncodeFullRange, 0, false},
+		{"full range past max", EncodeFullRange, MaxMileage + 1, false},
+		{"full range max", EncodeFullRange, MaxFullRangeMileage, false},
+		{"full range negative", EncodeFullRange, -1, true},
+		{"full range overflow", EncodeFullRange, MaxFullRangeMileage + 1, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			buf, err := c.encode(c.mileage)
+			if c.expectErr {
+				if err == nil {
+					t.Fatalf("Expected an error encoding %d, got none", c.mileage)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error encoding %d. Error: %s", c.mileage, err)
+			}
+			if len(buf) != BlockSize {
+				t.Fatalf("Expected a %d byte block, got %d bytes", BlockSize, len(buf))
+			}
+		})
+	}
+}
+
+func TestEncodeZero(t *testing.T) {
+	buf, err := Encode(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The new value 0 is only in the first slot, the old value -1 encodes to
+	// 0xFFFE, and every other slot is inverted.
+	expected := []byte{0x00, 0x00}
+	for count := 1; count < 16; count++ {
+		if count%2 == 1 {
+			expected = append(expected, 0x00, 0x01)
+		} else {
+			expected = append(expected, 0xFF, 0xFE)
+		}
+	}
+	if !bytes.Equal(buf, expected) {
+		t.Fatalf("Expected\n%x\ngot\n%x", expected, buf)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for mileage := 0; mileage <= MaxFullRangeMileage; mileage++ {
+		buf, err := EncodeFullRange(mileage)
+		if err != nil {
+			t.Fatalf("Unexpected error encoding %d. Error: %s", mileage, err)
+		}
+		decoded, err := Decode(buf)
+		if err != nil {
+			t.Fatalf("Unexpected error decoding %d. Error: %s", mileage, err)
+		}
+		if decoded != mileage {
+			t.Fatalf("Encoded %d, but decoded %d", mileage, decoded)
+		}
+	}
+}
+
+func TestDecodeDoesNotModifyInput(t *testing.T) {
+	buf, _ := Encode(157889)
+	original := append([]byte(nil), buf...)
+
+	if _, err := Decode(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, original) {
+		t.Fatalf("Decode modified the block.\nBefore\n%x\nAfter\n%x", original, buf)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	valid, _ := Encode(116)
+
+	wrongOld := append([]byte(nil), valid...)
+	for count := 8; count < 16; count++ {
+		wrongOld[count*2+1] ^= 0x10
+	}
+
+	interleaved := append([]byte(nil), valid...)
+	copy(interleaved[28:30], valid[0:2])
+
+	cases := []struct {
+		name        string
+		buf         []byte
+		expectBlank bool
+	}{
+		{"short", valid[:BlockSize-1], false},
+		{"long", append(append([]byte(nil), valid...), 0x00), false},
+		{"erased", bytes.Repeat([]byte{0xFF}, BlockSize), true},
+		{"cleared", bytes.Repeat([]byte{0x00}, BlockSize), true},
+		{"old value not one less", wrongOld, false},
+		{"new value after old value", interleaved, false},
+		{"wrong repeat pattern", append(append([]byte(nil), valid[2:]...), valid[:2]...), false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := Decode(c.buf)
+			if err == nil {
+				t.Fatal("Expected an error, got none")
+			}
+			if c.expectBlank && err != ErrBlank {
+				t.Fatalf("Expected ErrBlank, got %s", err)
+			}
+			if _, ok := err.(*CorruptBlockError); !c.expectBlank && !ok {
+				t.Fatalf("Expected a *CorruptBlockError, got %T", err)
+			}
+		})
+	}
+}
+
+func TestDecodeEveryNibble(t *testing.T) {
+	// No low nibble is invalid, each decodes to a different one
+	seen := make(map[int]bool)
+	for nibble := 0; nibble < 16; nibble++ {
+		decoded := decodeValue(0x1230 | nibble)
+		if decoded&0xFFF0 != 0x1230 || seen[decoded] {
+			t.Fatalf("Expected 0x%04X to decode to a new value from 0x1230 to 0x123F, got 0x%04X", 0x1230|nibble, decoded)
+		}
+		if encode_table[decoded&0x0F] != byte(nibble) {
+			t.Fatalf("Expected 0x%04X to encode back to 0x%04X", decoded, 0x1230|nibble)
+		}
+		seen[decoded] = true
+	}
+}
+
+func TestDecodeCorruptDoesNotModifyInput(t *testing.T) {
+	valid, _ := Encode(116)
+	blocks := [][]byte{
+		bytes.Repeat([]byte{0xFF}, BlockSize),
+		append(append([]byte(nil), valid[2:]...), valid[:2]...),
+	}
+	for _, buf := range blocks {
+		original := append([]byte(nil), buf...)
+		if _, err := Decode(buf); err == nil {
+			t.Fatalf("Expected an error decoding % X, got none", buf)
+		}
+		if !bytes.Equal(buf, original) {
+			t.Fatalf("Decode modified the block.\nBefore\n%x\nAfter\n%x", original, buf)
+		}
+	}
+}
+
+func TestAddresses(t *testing.T) {
+	end := 0
+	for _, addr := range Addresses {
+		offset := addr * 2
+		if offset < end || offset+BlockSize > EEPROMSize {
+			t.Errorf("The copy at word address 0x%X overlaps another copy, or lies outside the %d byte EEPROM", addr, EEPROMSize)
+		}
+		end = offset + BlockSize
+	}
+}
+
+func TestImage(t *testing.T) {
+	// A full dump of the right-vertical EEPROM, like eeprom read saves
+	image := bytes.Repeat([]byte{0xA5}, EEPROMSize)
+	first, _ := Encode(157889)
+	second, _ := Encode(157890)
+	copy(image[0xC0:], first)
+	copy(image[0xE0:], second)
+
+	blocks, err := ImageBlocks(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range []int{157889, 157890} {
+		if mileage, err := Decode(blocks[i]); err != nil || mileage != expected {
+			t.Fatalf("Expected copy %d to decode to %d, got %d. Error: %v", i, expected, mileage, err)
+		}
+	}
+
+	if err := PatchImage(image, 42); err != nil {
+		t.Fatal(err)
+	}
+	if len(image) != EEPROMSize {
+		t.Fatalf("Expected the patched dump to stay %d bytes, got %d", EEPROMSize, len(image))
+	}
+	for i, block := range blocks {
+		if mileage, err := Decode(block); err != nil || mileage != 42 {
+			t.Fatalf("Expected copy %d to decode to 42 after patching, got %d. Error: %v", i, mileage, err)
+		}
+	}
+	if !bytes.Equal(image[:0xC0], bytes.Repeat([]byte{0xA5}, 0xC0)) {
+		t.Fatalf("Expected the dump before the odometer to be untouched, got\n% X", image[:0xC0])
+	}
+
+	if _, err := ImageBlocks(image[:0xF0]); err == nil {
+		t.Fatal("Expected an error for a dump too short to hold both copies, got none")
+	}
+	if err := PatchImage(image, MaxMileage+1); err == nil {
+		t.Fatal("Expected an error patching a mileage out of range, got none")
+	}
+}